@@ -0,0 +1,338 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Principal is the identity resolved from the credentials of a request.
+type Principal struct {
+	Name   string                 `json:"name"`
+	Roles  []string               `json:"roles,omitempty"`
+	Scheme string                 `json:"scheme,omitempty"` // e.g. "basic", "bearer", "apikey"
+	Attrs  map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// An Authenticator turns the credentials of a request into a principal.
+// It returns a nil principal and a nil error when the request carries no
+// credentials it understands, and ErrUnauthorized (or another error) when the
+// credentials are invalid.
+type Authenticator interface {
+	Authenticate(req *Request) (*Principal, error)
+}
+
+// AuthChallenger is implemented by the authenticators which ask the client for
+// credentials through the WWW-Authenticate header of a 401 response.
+type AuthChallenger interface {
+	Challenge() string
+}
+
+type AuthenticatorFunc func(req *Request) (*Principal, error)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+func (fn AuthenticatorFunc) Authenticate(req *Request) (*Principal, error) {
+	return fn(req)
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, v := range p.Roles {
+		if v == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthFilter sets Controller.User with the principal of the first authenticator
+// accepting the request. It never rejects a request by itself, see RequireAuth
+// and RequireRole.
+func AuthFilter(auths ...Authenticator) Filter {
+	return func(c *Controller) {
+		for _, auth := range auths {
+			if ch, ok := auth.(AuthChallenger); ok && ch.Challenge() != "" {
+				c.authChallenges = append(c.authChallenges, ch.Challenge())
+			}
+			if c.User != nil {
+				continue
+			}
+			p, err := auth.Authenticate(c.Request)
+			if err != nil {
+				slog.Debug("httpsrv auth fail", "path", c.Request.UrlPath(), "err", err)
+				continue
+			}
+			c.User = p
+		}
+	}
+}
+
+// RequireAuth answers 401 to the requests without an authenticated principal.
+func RequireAuth(c *Controller) {
+	if c.User != nil {
+		return
+	}
+	for _, v := range c.authChallenges {
+		c.Response.Header().Add("WWW-Authenticate", v)
+	}
+	c.RenderError(http.StatusUnauthorized, "401 Unauthorized")
+}
+
+// RequireRole answers 401 to the requests without an authenticated principal,
+// and 403 to the ones whose principal has none of the roles.
+func RequireRole(roles ...string) Filter {
+	return func(c *Controller) {
+		if c.User == nil {
+			RequireAuth(c)
+			return
+		}
+		for _, role := range roles {
+			if c.User.HasRole(role) {
+				return
+			}
+		}
+		c.RenderError(http.StatusForbidden, "403 Forbidden")
+	}
+}
+
+// BasicAuthenticator implements the HTTP Basic scheme with the users of an
+// htpasswd-style file. Each line is "name:hash" or "name:hash:role1,role2",
+// where hash is a bcrypt ($2y$, $2a$, $2b$) or a {SHA} password hash.
+type BasicAuthenticator struct {
+	Realm string
+
+	mu    sync.RWMutex
+	file  string
+	users map[string]*basicUser
+}
+
+// basicDummyHash is checked for the unknown user names.
+const basicDummyHash = "$2a$10$zf46urvQc1aH7M1e7HBVZec3nnrcKg4FpqSv9BXGVRLGczxKbFZya"
+
+type basicUser struct {
+	hash  string
+	roles []string
+}
+
+func NewBasicAuthenticator(realm, file string) (*BasicAuthenticator, error) {
+	it := &BasicAuthenticator{
+		Realm: realm,
+		file:  file,
+		users: map[string]*basicUser{},
+	}
+	if file != "" {
+		if err := it.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return it, nil
+}
+
+// Reload reads the users again from the htpasswd file.
+func (it *BasicAuthenticator) Reload() error {
+
+	b, err := os.ReadFile(it.file)
+	if err != nil {
+		return err
+	}
+
+	var (
+		users = map[string]*basicUser{}
+		scan  = bufio.NewScanner(bytes.NewReader(b))
+	)
+
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		u := &basicUser{
+			hash: fields[1],
+		}
+		if len(fields) == 3 && fields[2] != "" {
+			u.roles = strings.Split(fields[2], ",")
+		}
+		users[fields[0]] = u
+	}
+
+	it.mu.Lock()
+	it.users = users
+	it.mu.Unlock()
+
+	return nil
+}
+
+// SetUser adds or replaces a user with its password hash.
+func (it *BasicAuthenticator) SetUser(name, hash string, roles ...string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.users[name] = &basicUser{
+		hash:  hash,
+		roles: roles,
+	}
+}
+
+func (it *BasicAuthenticator) Challenge() string {
+	return `Basic realm="` + strings.ReplaceAll(it.Realm, `"`, "") + `", charset="UTF-8"`
+}
+
+func (it *BasicAuthenticator) Authenticate(req *Request) (*Principal, error) {
+
+	name, pass, ok := req.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	it.mu.RLock()
+	u, ok := it.users[name]
+	it.mu.RUnlock()
+
+	if !ok {
+		// spend the time of a bcrypt check, not to tell the unknown names
+		passwordHashMatch(basicDummyHash, pass)
+		return nil, ErrUnauthorized
+	}
+
+	if !passwordHashMatch(u.hash, pass) {
+		return nil, ErrUnauthorized
+	}
+
+	return &Principal{
+		Name:   name,
+		Roles:  append([]string(nil), u.roles...),
+		Scheme: "basic",
+	}, nil
+}
+
+func passwordHashMatch(hash, pass string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		return subtle.ConstantTimeCompare([]byte(hash[5:]),
+			[]byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+	return false
+}
+
+// TokenAuthenticator accepts a static set of bearer tokens or API keys.
+type TokenAuthenticator struct {
+	scheme string
+	name   string
+
+	mu     sync.RWMutex
+	tokens map[[sha256.Size]byte]*Principal
+}
+
+// NewBearerAuthenticator accepts the tokens sent in the
+// "Authorization: Bearer <token>" header.
+func NewBearerAuthenticator(tokens map[string]*Principal) *TokenAuthenticator {
+	return newTokenAuthenticator("bearer", "Authorization", tokens)
+}
+
+// NewAPIKeyAuthenticator accepts the keys sent in the header, or else the
+// query parameter, of the given name, e.g. "X-Api-Key".
+func NewAPIKeyAuthenticator(name string, keys map[string]*Principal) *TokenAuthenticator {
+	return newTokenAuthenticator("apikey", name, keys)
+}
+
+func newTokenAuthenticator(scheme, name string, tokens map[string]*Principal) *TokenAuthenticator {
+	it := &TokenAuthenticator{
+		scheme: scheme,
+		name:   name,
+		tokens: map[[sha256.Size]byte]*Principal{},
+	}
+	for k, p := range tokens {
+		it.Set(k, p)
+	}
+	return it
+}
+
+// Set adds or replaces a token.
+func (it *TokenAuthenticator) Set(token string, p *Principal) {
+	if token == "" || p == nil {
+		return
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.tokens[sha256.Sum256([]byte(token))] = p
+}
+
+// Delete revokes a token.
+func (it *TokenAuthenticator) Delete(token string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	delete(it.tokens, sha256.Sum256([]byte(token)))
+}
+
+func (it *TokenAuthenticator) Challenge() string {
+	if it.scheme == "bearer" {
+		return "Bearer"
+	}
+	return ""
+}
+
+func (it *TokenAuthenticator) Authenticate(req *Request) (*Principal, error) {
+
+	var token string
+
+	if it.scheme == "bearer" {
+		token = bearerToken(req.Header.Get("Authorization"))
+	} else if token = req.Header.Get(it.name); token == "" {
+		token = req.URL.Query().Get(it.name)
+	}
+
+	if token == "" {
+		return nil, nil
+	}
+
+	it.mu.RLock()
+	p, ok := it.tokens[sha256.Sum256([]byte(token))]
+	it.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	p2 := *p
+	p2.Scheme = it.scheme
+	return &p2, nil
+}
+
+func bearerToken(v string) string {
+	if len(v) > 7 && strings.EqualFold(v[:7], "Bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+	return ""
+}
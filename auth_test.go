@@ -0,0 +1,270 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthenticator(t *testing.T) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	data := "# users\n" +
+		"alice:" + string(hash) + ":admin,dev\n" +
+		"bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n" // "secret"
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewBasicAuthenticator("test", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, pass string
+		wantErr    bool
+		wantAdmin  bool
+	}{
+		{"alice", "secret", false, true},
+		{"alice", "wrong", true, false},
+		{"bob", "secret", false, false},
+		{"carol", "secret", true, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(tt.user, tt.pass)
+		p, err := auth.Authenticate(newRequest(r))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected err %v, got %v", tt.user, tt.wantErr, err)
+			continue
+		}
+		if err == nil && (p.Name != tt.user || p.HasRole("admin") != tt.wantAdmin) {
+			t.Errorf("%s: unexpected principal %+v", tt.user, p)
+		}
+	}
+
+	// no credentials
+	if p, err := auth.Authenticate(newRequest(httptest.NewRequest("GET", "/", nil))); p != nil || err != nil {
+		t.Errorf("expected no principal and no error, got %v, %v", p, err)
+	}
+
+	// the roles of the principal are a copy
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("alice", "secret")
+	if p, err := auth.Authenticate(newRequest(r)); err == nil {
+		p.Roles[0] = "guest"
+	}
+	if p, err := auth.Authenticate(newRequest(r)); err != nil || !p.HasRole("admin") {
+		t.Errorf("expected the stored roles unchanged, got %v, %v", p, err)
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+
+	bearer := NewBearerAuthenticator(map[string]*Principal{
+		"token-1": {Name: "svc", Roles: []string{"reader"}},
+	})
+	apikey := NewAPIKeyAuthenticator("X-Api-Key", map[string]*Principal{
+		"key-1": {Name: "partner"},
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer token-1")
+	if p, err := bearer.Authenticate(newRequest(r)); err != nil || p.Name != "svc" || p.Scheme != "bearer" {
+		t.Errorf("unexpected bearer result %+v, %v", p, err)
+	}
+
+	r = httptest.NewRequest("GET", "/?X-Api-Key=key-1", nil)
+	if p, err := apikey.Authenticate(newRequest(r)); err != nil || p.Name != "partner" || p.Scheme != "apikey" {
+		t.Errorf("unexpected api key result %+v, %v", p, err)
+	}
+
+	bearer.Delete("token-1")
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer token-1")
+	if _, err := bearer.Authenticate(newRequest(r)); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for a revoked token, got %v", err)
+	}
+}
+
+func TestRequireRoleModuleFilters(t *testing.T) {
+
+	auth := NewBearerAuthenticator(map[string]*Principal{
+		"admin-token": {Name: "root", Roles: []string{"admin"}},
+		"user-token":  {Name: "guest"},
+	})
+
+	mod := NewModule()
+	mod.Config.Filters = []Filter{AuthFilter(auth), RequireAuth}
+	mod.RegisterAction("/profile", func(ctx Ctx) error {
+		return ctx.Send([]byte("hello " + ctx.User().Name))
+	})
+	mod.RegisterAction("/admin", func(ctx Ctx) error {
+		return ctx.Send([]byte("admin area"))
+	})
+	mod.SetRouteConfig("/admin", RouteConfig{
+		Filters: []Filter{RequireRole("admin")},
+	})
+
+	srv := NewService()
+	srv.HandleModule("/v1", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{"/v1/profile/", "", http.StatusUnauthorized, "401 Unauthorized"},
+		{"/v1/profile/", "user-token", http.StatusOK, "hello guest"},
+		{"/v1/admin/", "user-token", http.StatusForbidden, "403 Forbidden"},
+		{"/v1/admin/", "admin-token", http.StatusOK, "admin area"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("%s %s: expected %d %q, got %d %q",
+				tt.path, tt.token, tt.status, tt.body, rec.Code, rec.Body.String())
+		}
+		if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("expected a bearer challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestRequireAuthFileServer(t *testing.T) {
+
+	auth := NewBearerAuthenticator(map[string]*Principal{
+		"user-token": {Name: "guest"},
+	})
+
+	mod := NewModule()
+	mod.Config.Filters = []Filter{AuthFilter(auth), RequireAuth}
+	mod.RegisterFileServer("/static", "", http.FS(fstest.MapFS{
+		"app.js": {Data: []byte("console.log(1)")},
+	}))
+
+	srv := NewService()
+	srv.HandleModule("/v1", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		token  string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"bad-token", http.StatusUnauthorized},
+		{"user-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/static/app.js", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if rec.Code != tt.status {
+			t.Errorf("%q: expected %d, got %d %q", tt.token, tt.status, rec.Code, rec.Body.String())
+		}
+		if tt.status == http.StatusOK && rec.Body.String() != "console.log(1)" {
+			t.Errorf("expected the file, got %q", rec.Body.String())
+		}
+	}
+}
+
+type authTestAdmin struct {
+	*Controller
+}
+
+func (c authTestAdmin) IndexAction() {
+	c.RenderString("admin " + c.User.Name)
+}
+
+func TestRequireAuthUnknownAction(t *testing.T) {
+
+	auth := NewBearerAuthenticator(map[string]*Principal{
+		"user-token": {Name: "guest"},
+	})
+
+	mod := NewModule()
+	mod.Config.Filters = []Filter{AuthFilter(auth), RequireAuth}
+	mod.RegisterController(new(authTestAdmin))
+	mod.SetRoute("/{controller}/{action}", nil)
+
+	srv := NewService()
+	srv.HandleModule("/admin", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/admin/auth-test-admin/index", "", http.StatusUnauthorized},
+		{"/admin/auth-test-admin/index", "user-token", http.StatusOK},
+		{"/admin/other/x", "", http.StatusUnauthorized},
+		{"/admin/other/x", "user-token", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %q: expected %d, got %d %q", tt.path, tt.token, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,511 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError is the error of a single field of a bound struct.
+type FieldError struct {
+	Field string // name of the parameter, dotted for the nested structs
+	Value string
+
+	// Rule is the failed validation rule and Param its parameter, e.g. "min"
+	// and "3", both empty for the conversion errors.
+	Rule  string
+	Param string
+
+	Err error // conversion error
+}
+
+// FieldErrors lists the fields of a struct which failed to bind or validate.
+type FieldErrors []*FieldError
+
+var (
+	ErrBindTarget   = errors.New("bind target must be a non-nil pointer to a struct")
+	ErrParamMissing = errors.New("missing parameter")
+
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	bindTimeLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+)
+
+func (e *FieldError) Error() string {
+	if e.Rule != "" || e.Err == nil {
+		return e.Message(i18nDefLocale)
+	}
+	err := e.Err
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	return fmt.Sprintf("invalid value %q of %s: %v", e.Value, e.Field, err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Bind fills the struct dst with the body of the request, if any, decoded
+// by Request.Decode, and the parameters named by the field tags, e.g.
+//
+//	var q struct {
+//		ID      int64     `param:"id" from:"path"`
+//		Tags    []string  `param:"tag"`
+//		Since   time.Time `param:"since" layout:"2006-01-02"`
+//		Token   string    `param:"X-Token" from:"header"`
+//		Page    *int      // param "page"
+//		Address struct {
+//			City string // param "address.city"
+//		}
+//	}
+//	if err := c.Params.Bind(&q); err != nil {
+//		...
+//	}
+//
+// A field reads the parameter from "path", "query", "form", "header" or
+// "cookie", or without a from tag the first one of the path, query and form
+// values. The default name of a parameter is the snake case of the field
+// name, and `param:"-"` skips a field. The fields without a value are left
+// untouched. The struct is then checked with Validate, and the conversion and
+// validation errors are returned as FieldErrors.
+func (p *Params) Bind(dst any) error {
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+
+	// The forms are bound field by field below, the other bodies with the
+	// decoder of their type.
+	if p.req != nil && p.req.ContentType != "application/x-www-form-urlencoded" &&
+		p.req.ContentType != "multipart/form-data" && lookupDecoder(p.req.ContentType) != nil {
+		body := p.req.RawBody()
+		if p.req.bodyErr != nil {
+			return p.req.bodyErr
+		}
+		if len(body) > 0 {
+			if err := p.req.Decode(dst); err != nil {
+				return err
+			}
+		}
+	}
+
+	var errs FieldErrors
+
+	if p.request != nil {
+		p.init()
+		if _, err := p.bindStruct(rv.Elem(), "", "", &errs); err != nil {
+			return err
+		}
+	}
+
+	// Validate the fields which were converted.
+	skip := map[string]bool{}
+	for _, fe := range errs {
+		skip[fe.Field] = true
+	}
+	if err := validateStruct(rv.Elem(), "", skip, &errs); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// bindStruct binds the fields of v, and reports whether any was set.
+func (p *Params) bindStruct(v reflect.Value, prefix, from string, errs *FieldErrors) (bool, error) {
+
+	var (
+		t   = v.Type()
+		set = false
+	)
+
+	if p.binding == nil {
+		p.binding = map[reflect.Type]bool{}
+	}
+	if !p.binding[t] {
+		p.binding[t] = true
+		defer delete(p.binding, t)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+
+		var (
+			sf   = t.Field(i)
+			fv   = v.Field(i)
+			name = sf.Tag.Get("param")
+		)
+
+		// The exported fields of an embedded struct are promoted, even when
+		// its type is not exported.
+		if name == "-" || (!sf.IsExported() &&
+			(!sf.Anonymous || sf.Type.Kind() != reflect.Struct)) {
+			continue
+		}
+
+		fieldFrom := from
+		if s := sf.Tag.Get("from"); s != "" {
+			fieldFrom = s
+		}
+
+		if st := bindStructType(sf.Type); st != nil {
+
+			childPrefix := prefix
+			if !sf.Anonymous || name != "" {
+				if name == "" {
+					name = snakeCase(sf.Name)
+				}
+				childPrefix = prefix + name + "."
+			}
+
+			if sf.Type.Kind() != reflect.Pointer {
+				ok, err := p.bindStruct(fv, childPrefix, fieldFrom, errs)
+				if err != nil {
+					return false, err
+				}
+				set = set || ok
+				continue
+			}
+
+			// A recursive type, e.g. the Parent *Node of a Node, is followed
+			// only as deep as the query and form keys.
+			if p.binding[st] && !p.hasNestedKeys(fieldFrom, childPrefix) {
+				continue
+			}
+
+			// Allocate the nested struct only when one of its fields is set.
+			nv := fv
+			if fv.IsNil() {
+				nv = reflect.New(st)
+			}
+			ok, err := p.bindStruct(nv.Elem(), childPrefix, fieldFrom, errs)
+			if err != nil {
+				return false, err
+			}
+			if ok && fv.IsNil() {
+				fv.Set(nv)
+			}
+			set = set || ok
+			continue
+		}
+
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		name = prefix + name
+
+		if sf.Type.Kind() == reflect.Slice {
+			if et := bindStructType(sf.Type.Elem()); et != nil {
+				ok, err := p.bindStructSlice(fv, et, name, fieldFrom, errs)
+				if err != nil {
+					return false, err
+				}
+				set = set || ok
+				continue
+			}
+		}
+
+		if sf.Type.Kind() == reflect.Map && sf.Type.Key().Kind() == reflect.String {
+			ok, err := p.bindMap(fv, name, fieldFrom, sf.Tag.Get("layout"), errs)
+			if err != nil {
+				return false, err
+			}
+			set = set || ok
+			continue
+		}
+
+		vals, err := p.bindValues(fieldFrom, name)
+		if err != nil {
+			return false, err
+		}
+		if len(vals) == 0 {
+			continue
+		}
+
+		if err := bindValue(fv, vals, sf.Tag.Get("layout")); err != nil {
+			*errs = append(*errs, &FieldError{
+				Field: name,
+				Value: vals[0],
+				Err:   err,
+			})
+			continue
+		}
+		set = true
+	}
+
+	return set, nil
+}
+
+// bindStructSlice binds the elements of a slice of structs, e.g. from
+// "items[0][id]" or "items.0.id", ordered by index and packed as Nested.
+func (p *Params) bindStructSlice(v reflect.Value, et reflect.Type, name, from string, errs *FieldErrors) (bool, error) {
+
+	indexes := p.nestedIndexes(from, name)
+	if len(indexes) == 0 {
+		return false, nil
+	}
+
+	sv := reflect.MakeSlice(v.Type(), len(indexes), len(indexes))
+	for n, i := range indexes {
+		ev := sv.Index(n)
+		if ev.Kind() == reflect.Pointer {
+			ev.Set(reflect.New(et))
+			ev = ev.Elem()
+		}
+		var (
+			prefix = name + "." + strconv.Itoa(i) + "."
+			start  = len(*errs)
+		)
+		if _, err := p.bindStruct(ev, prefix, from, errs); err != nil {
+			return false, err
+		}
+		// The errors name the element by its position, as the validation.
+		for _, fe := range (*errs)[start:] {
+			fe.Field = name + "." + strconv.Itoa(n) + "." + strings.TrimPrefix(fe.Field, prefix)
+		}
+	}
+	v.Set(sv)
+
+	return true, nil
+}
+
+// bindMap binds the entries of a map with string keys, e.g. from
+// "meta[color]" or "meta.color".
+func (p *Params) bindMap(v reflect.Value, name, from, layout string, errs *FieldErrors) (bool, error) {
+
+	keys := p.nestedKeys(from, name)
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	mv := reflect.MakeMapWithSize(v.Type(), len(keys))
+	for _, key := range keys {
+		vals, err := p.bindValues(from, name+"."+key)
+		if err != nil {
+			return false, err
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if err := bindValue(ev, vals, layout); err != nil {
+			*errs = append(*errs, &FieldError{
+				Field: name + "." + key,
+				Value: vals[0],
+				Err:   err,
+			})
+			continue
+		}
+		mv.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), ev)
+	}
+	v.Set(mv)
+
+	return true, nil
+}
+
+// bindStructType returns the struct type of a nested struct field, or nil
+// for the other fields, including the structs bound from a single value.
+func bindStructType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType ||
+		reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+	return t
+}
+
+// bindValues returns the values of a field, the query and form values by
+// their name or the dotted name of a bracket key.
+func (p *Params) bindValues(from, name string) ([]string, error) {
+	return p.sourceLookup(from, name, nestedValues)
+}
+
+// sourceLookup returns the values of name in a source, the query and form
+// values read with get.
+func (p *Params) sourceLookup(from, name string, get func(url.Values, string) []string) ([]string, error) {
+
+	r := p.request
+
+	switch from {
+
+	case "":
+		if v := r.PathValue(name); v != "" {
+			return []string{v}, nil
+		}
+		if vs := get(p.values, name); len(vs) > 0 {
+			return vs, nil
+		}
+		return get(r.PostForm, name), nil
+
+	case "path":
+		if v := r.PathValue(name); v != "" {
+			return []string{v}, nil
+		}
+
+	case "query":
+		return get(p.values, name), nil
+
+	case "form":
+		return get(r.PostForm, name), nil
+
+	case "header":
+		return r.Header.Values(name), nil
+
+	case "cookie":
+		if ck, err := r.Cookie(name); err == nil {
+			return []string{ck.Value}, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown bind source %q of %s", from, name)
+	}
+
+	return nil, nil
+}
+
+func bindValue(v reflect.Value, vals []string, layout string) error {
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 &&
+		!reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+
+		sv := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := bindScalar(sv.Index(i), s, layout); err != nil {
+				return err
+			}
+		}
+		v.Set(sv)
+		return nil
+	}
+
+	return bindScalar(v, vals[0], layout)
+}
+
+func bindScalar(v reflect.Value, s, layout string) error {
+
+	if v.Kind() == reflect.Pointer {
+		nv := reflect.New(v.Type().Elem())
+		if err := bindScalar(nv.Elem(), s, layout); err != nil {
+			return err
+		}
+		v.Set(nv)
+		return nil
+	}
+
+	switch v.Type() {
+
+	case timeType:
+		t, err := parseBindTime(s, layout)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := parseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.Slice:
+		// []byte
+		v.SetBytes([]byte(s))
+
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func parseBindTime(s, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, s)
+	}
+	for _, layout := range bindTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time")
+}
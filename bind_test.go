@@ -0,0 +1,219 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	City string
+	Zip  *int
+}
+
+type bindPaging struct {
+	Page  int `param:"page"`
+	Limit int `param:"limit"`
+}
+
+type bindQuery struct {
+	bindPaging
+	ID       int64         `param:"id" from:"path"`
+	Tags     []string      `param:"tag"`
+	Since    time.Time     `param:"since" layout:"2006-01-02"`
+	Timeout  time.Duration `param:"timeout"`
+	Token    string        `param:"X-Token" from:"header"`
+	Theme    string        `param:"theme" from:"cookie"`
+	Verbose  *bool
+	IP       net.IP `param:"ip"`
+	Address  bindAddress
+	Shipping *bindAddress
+	Ignored  string `param:"-"`
+}
+
+func TestParamsBind(t *testing.T) {
+
+	r := httptest.NewRequest("GET", "/users/42?tag=a&tag=b&since=2024-05-01&timeout=3s"+
+		"&verbose=true&ip=10.0.0.1&address.city=Paris&address.zip=75001&page=2&ignored=x", nil)
+	r.SetPathValue("id", "42")
+	r.Header.Set("X-Token", "secret")
+	r.Header.Set("Cookie", "theme=dark")
+
+	var q bindQuery
+	p := &Params{request: r, req: newRequest(r)}
+	if err := p.Bind(&q); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"path", q.ID == 42},
+		{"slice", len(q.Tags) == 2 && q.Tags[1] == "b"},
+		{"time", q.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))},
+		{"duration", q.Timeout == 3*time.Second},
+		{"header", q.Token == "secret"},
+		{"cookie", q.Theme == "dark"},
+		{"pointer", q.Verbose != nil && *q.Verbose},
+		{"text unmarshaler", q.IP.Equal(net.ParseIP("10.0.0.1"))},
+		{"nested", q.Address.City == "Paris" && q.Address.Zip != nil && *q.Address.Zip == 75001},
+		{"nested pointer unset", q.Shipping == nil},
+		{"embedded", q.Page == 2},
+		{"skipped", q.Ignored == ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.ok {
+				t.Errorf("unexpected value %+v", q)
+			}
+		})
+	}
+}
+
+func TestParamsBindJSON(t *testing.T) {
+
+	r := httptest.NewRequest("POST", "/users/7", strings.NewReader(`{"name":"alice","age":30}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.SetPathValue("id", "7")
+
+	var v struct {
+		ID   int    `json:"-" param:"id" from:"path"`
+		Name string `json:"name" param:"-"`
+		Age  int    `json:"age" param:"-"`
+	}
+
+	p := &Params{request: r, req: newRequest(r)}
+	if err := p.Bind(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 7 || v.Name != "alice" || v.Age != 30 {
+		t.Errorf("unexpected value %+v", v)
+	}
+}
+
+func TestParamsBindErrors(t *testing.T) {
+
+	r := httptest.NewRequest("GET", "/?page=x&limit=10&since=yesterday", nil)
+
+	var q bindQuery
+	p := &Params{request: r}
+	err := p.Bind(&q)
+
+	var errs FieldErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 field errors, got %v", err)
+	}
+	if errs[0].Field != "page" || errs[1].Field != "since" {
+		t.Errorf("unexpected fields %v", errs)
+	}
+	if q.Limit != 10 {
+		t.Errorf("expected the valid fields to be set, got %+v", q)
+	}
+
+	if err := p.Bind(q); err != ErrBindTarget {
+		t.Errorf("expected ErrBindTarget, got %v", err)
+	}
+}
+
+func TestParamsBindNested(t *testing.T) {
+
+	type item struct {
+		ID  int    `param:"id" validate:"min=1"`
+		Tag string `param:"tag"`
+	}
+
+	var v struct {
+		User struct {
+			Name string
+			Tags []string
+		}
+		Items []item
+		Refs  []*item
+		Meta  map[string]int
+	}
+
+	r := httptest.NewRequest("GET", "/?user[name]=x&user[tags][]=a&user[tags][]=b"+
+		"&items[0][id]=3&items[0][tag]=new&items[2][id]=5&refs.0.id=7&meta[w]=2&meta[h]=4", nil)
+
+	p := &Params{request: r}
+	if err := p.Bind(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"map", v.User.Name == "x"},
+		{"list", len(v.User.Tags) == 2 && v.User.Tags[1] == "b"},
+		// items[2] is packed to the second element
+		{"structs", len(v.Items) == 2 && v.Items[0].ID == 3 && v.Items[0].Tag == "new" && v.Items[1].ID == 5},
+		{"struct pointers", len(v.Refs) == 1 && v.Refs[0].ID == 7},
+		{"values map", len(v.Meta) == 2 && v.Meta["w"] == 2 && v.Meta["h"] == 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.ok {
+				t.Errorf("unexpected value %+v", v)
+			}
+		})
+	}
+
+	r = httptest.NewRequest("GET", "/?items[2][id]=x&items[4][id]=-1&meta[w]=y", nil)
+	p = &Params{request: r}
+
+	var errs FieldErrors
+	if err := p.Bind(&v); !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("expected 3 field errors, got %v", err)
+	}
+	for i, field := range []string{"items.0.id", "meta.w", "items.1.id"} {
+		if errs[i].Field != field {
+			t.Errorf("expected field %s, got %s", field, errs[i].Field)
+		}
+	}
+}
+
+type bindNode struct {
+	Name     string
+	Parent   *bindNode
+	Children []bindNode
+}
+
+func TestParamsBindRecursive(t *testing.T) {
+
+	r := httptest.NewRequest("GET", "/?name=a&parent[name]=b&parent[parent][name]=c&children[0][name]=d", nil)
+
+	var v bindNode
+	p := &Params{request: r}
+	if err := p.Bind(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Name != "a" || v.Parent == nil || v.Parent.Name != "b" ||
+		v.Parent.Parent == nil || v.Parent.Parent.Name != "c" || v.Parent.Parent.Parent != nil {
+		t.Errorf("unexpected parents %+v", v)
+	}
+	if len(v.Children) != 1 || v.Children[0].Name != "d" || v.Children[0].Parent != nil {
+		t.Errorf("unexpected children %+v", v.Children)
+	}
+}
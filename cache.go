@@ -0,0 +1,343 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hooto/httpsrv/internal/lru"
+)
+
+// CachedResponse is a full response stored by a ResponseCache.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Tags    map[string]uint64 // tag generations at store time
+	Expires time.Time
+}
+
+// CacheStore is the storage backend of a ResponseCache.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, v *CachedResponse, ttl time.Duration)
+	Delete(key string)
+}
+
+// ResponseCache is a filter caching the full responses of GET and HEAD
+// requests. It must be placed after the filters rejecting requests, such as
+// RequireAuth, e.g.
+//
+//	cache := httpsrv.NewResponseCache(10*time.Second, 1024)
+//	mod.Config.Filters = append(mod.Config.Filters, cache.Filter)
+//
+// Only 200 responses without Set-Cookie nor "Cache-Control: no-store/private"
+// are stored. A response with a Vary header is stored only when the headers it
+// names are part of the key, e.g. Vary must contain "Accept" for the actions
+// calling Negotiate or Respond. The requests with credentials (an Authorization
+// header, a session cookie or an authenticated Controller.User) bypass the
+// cache. Concurrent misses of a key are coalesced into a single call of the
+// action.
+//
+// The requests with a CSP nonce bypass the cache too, as the nonce is new for
+// each response. This is the case of every route under DefaultSecurityPolicy,
+// whose script-src has a nonce: the cached routes need a policy without one.
+type ResponseCache struct {
+	TTL time.Duration
+
+	// Request headers which are part of the cache key, e.g. "Accept-Language".
+	Vary []string
+
+	Store CacheStore
+
+	mu    sync.Mutex
+	tags  map[string]uint64
+	calls map[string]*cacheCall
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	entry *CachedResponse
+}
+
+type memoryCacheStore struct {
+	cache *lru.Cache
+}
+
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		TTL:   ttl,
+		Store: NewMemoryCacheStore(maxEntries),
+		tags:  map[string]uint64{},
+		calls: map[string]*cacheCall{},
+	}
+}
+
+// NewMemoryCacheStore returns a LRU store of up to maxEntries responses.
+func NewMemoryCacheStore(maxEntries int) CacheStore {
+	return &memoryCacheStore{
+		cache: lru.New(maxEntries),
+	}
+}
+
+func (it *memoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	v, ok := it.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*CachedResponse)
+	if time.Now().After(e.Expires) {
+		it.cache.Remove(key)
+		return nil, false
+	}
+	return e, true
+}
+
+func (it *memoryCacheStore) Set(key string, v *CachedResponse, ttl time.Duration) {
+	it.cache.Add(key, v)
+}
+
+func (it *memoryCacheStore) Delete(key string) {
+	it.cache.Remove(key)
+}
+
+// SetCacheTags sets the tags of the response, used to invalidate it with
+// ResponseCache.InvalidateTags.
+func (c *Controller) SetCacheTags(tags ...string) {
+	c.cacheTags = append(c.cacheTags, tags...)
+}
+
+// InvalidateTags drops the cached responses tagged with any of the tags.
+func (rc *ResponseCache) InvalidateTags(tags ...string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, tag := range tags {
+		rc.tags[tag]++
+	}
+}
+
+// Filter serves the cached response of a request, or arranges for the
+// response of the action to be stored.
+func (rc *ResponseCache) Filter(c *Controller) {
+
+	r := c.Request
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return
+	}
+
+	// The responses to a user, or with a nonce, are not to be shared.
+	if r.cspNonce != "" || rc.private(c) {
+		return
+	}
+
+	key := rc.key(c)
+
+	if e, ok := rc.get(key); ok {
+		rc.write(c, e)
+		return
+	}
+
+	rc.mu.Lock()
+	if call, ok := rc.calls[key]; ok {
+		rc.mu.Unlock()
+		select {
+		case <-call.done:
+			if call.entry != nil {
+				rc.write(c, call.entry)
+			}
+		case <-r.Context().Done():
+		}
+		return
+	}
+	call := &cacheCall{
+		done: make(chan struct{}),
+	}
+	rc.calls[key] = call
+	rc.mu.Unlock()
+
+	c.Response.commitHooks = append(c.Response.commitHooks, func(status int, header http.Header, body []byte) {
+
+		defer func() {
+			rc.mu.Lock()
+			delete(rc.calls, key)
+			rc.mu.Unlock()
+			close(call.done)
+		}()
+
+		if (status != 0 && status != http.StatusOK) || len(body) == 0 ||
+			header.Get("Set-Cookie") != "" {
+			return
+		}
+		if cc := header.Get("Cache-Control"); strings.Contains(cc, "no-store") ||
+			strings.Contains(cc, "private") {
+			return
+		}
+		if !rc.varyKeyed(c, header) {
+			return
+		}
+
+		e := &CachedResponse{
+			Status:  http.StatusOK,
+			Header:  header.Clone(),
+			Body:    append([]byte{}, body...),
+			Tags:    map[string]uint64{},
+			Expires: time.Now().Add(rc.TTL),
+		}
+		e.Header.Del("Content-Length")
+
+		rc.mu.Lock()
+		for _, tag := range c.cacheTags {
+			e.Tags[tag] = rc.tags[tag]
+		}
+		rc.mu.Unlock()
+
+		rc.Store.Set(key, e, rc.TTL)
+		call.entry = e
+	})
+}
+
+// private reports whether the request carries credentials.
+func (rc *ResponseCache) private(c *Controller) bool {
+
+	r := c.Request
+	if c.User != nil || r.Header.Get("Authorization") != "" {
+		return true
+	}
+
+	names := []string{DefaultConfig.CookieKeySession, DefaultConfig.CookieKeyToken}
+	if c.service != nil {
+		names = append(names, c.service.Config.CookieKeySession,
+			c.service.Config.CookieKeyToken, c.service.sessionManager().cookieName(c))
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// varyKeyed reports whether the headers named by the Vary of the response are
+// part of the cache key.
+func (rc *ResponseCache) varyKeyed(c *Controller, header http.Header) bool {
+
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+
+			switch {
+			case name == "":
+				continue
+
+			case name == "*":
+				return false
+
+			case name == "Accept-Encoding" && c.service != nil &&
+				c.service.Config.CompressResponse:
+				continue
+			}
+
+			keyed := false
+			for _, v2 := range rc.Vary {
+				if http.CanonicalHeaderKey(v2) == name {
+					keyed = true
+					break
+				}
+			}
+			if !keyed {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (rc *ResponseCache) key(c *Controller) string {
+
+	var (
+		r   = c.Request
+		key strings.Builder
+	)
+
+	key.WriteString(r.Host)
+	key.WriteString(r.URL.Path)
+	if r.URL.RawQuery != "" {
+		key.WriteString("?")
+		key.WriteString(r.URL.Query().Encode())
+	}
+
+	for _, name := range rc.Vary {
+		key.WriteString("\n")
+		key.WriteString(name)
+		key.WriteString(":")
+		key.WriteString(r.Header.Get(name))
+	}
+
+	if c.service != nil && c.service.Config.CompressResponse {
+		key.WriteString("\nEncoding:")
+		key.WriteString(compressEncoding(r.Header.Get("Accept-Encoding")))
+	}
+
+	return key.String()
+}
+
+func (rc *ResponseCache) get(key string) (*CachedResponse, bool) {
+
+	e, ok := rc.Store.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for tag, gen := range e.Tags {
+		if rc.tags[tag] != gen {
+			rc.Store.Delete(key)
+			return nil, false
+		}
+	}
+
+	return e, true
+}
+
+// write sends the cached response as is, bypassing the response compression.
+func (rc *ResponseCache) write(c *Controller, e *CachedResponse) {
+
+	h := c.Response.Header()
+	for k, v := range e.Header {
+		h[k] = append([]string{}, v...)
+	}
+
+	c.AutoRender = false
+	c.Response.compWriter = nil
+
+	if requestNotModified(c.Request.Request, h) {
+		c.Response.Status = http.StatusNotModified
+		return
+	}
+
+	c.Response.buf.Write(e.Body)
+	c.Response.Status = e.Status
+}
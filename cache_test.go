@@ -0,0 +1,212 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheTestPage struct {
+	*Controller
+}
+
+var cacheTestCalls int32
+
+func (c cacheTestPage) IndexAction() {
+	n := atomic.AddInt32(&cacheTestCalls, 1)
+	time.Sleep(20 * time.Millisecond)
+	c.SetCacheTags("page")
+	c.RenderString(fmt.Sprintf("render %d lang %s", n, c.Request.Header.Get("Accept-Language")))
+}
+
+func TestResponseCache(t *testing.T) {
+
+	cache := NewResponseCache(time.Minute, 16)
+	cache.Vary = []string{"Accept-Language"}
+
+	mod := NewModule()
+	mod.Config.Filters = []Filter{cache.Filter}
+	mod.RegisterController(new(cacheTestPage))
+
+	srv := NewService()
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	get := func(path, lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Language", lang)
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		return rec
+	}
+
+	// concurrent misses are coalesced
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := get("/cache-test-page/index?b=2&a=1", "en"); rec.Body.String() != "render 1 lang en" {
+				t.Errorf("unexpected body %q", rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&cacheTestCalls); n != 1 {
+		t.Fatalf("expected 1 action call, got %d", n)
+	}
+
+	// query order does not matter, vary headers do
+	if rec := get("/cache-test-page/index?a=1&b=2", "en"); rec.Body.String() != "render 1 lang en" {
+		t.Errorf("expected a cache hit, got %q", rec.Body.String())
+	}
+	if rec := get("/cache-test-page/index?a=1&b=2", "fr"); rec.Body.String() != "render 2 lang fr" {
+		t.Errorf("expected a cache miss, got %q", rec.Body.String())
+	}
+
+	cache.InvalidateTags("page")
+	if rec := get("/cache-test-page/index?a=1&b=2", "en"); rec.Code != http.StatusOK || rec.Body.String() != "render 3 lang en" {
+		t.Errorf("expected a new render after invalidation, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestResponseCachePrivate(t *testing.T) {
+
+	var calls int32
+
+	cache := NewResponseCache(time.Minute, 16)
+
+	mod := NewModule()
+	mod.Config.Filters = []Filter{cache.Filter}
+	mod.RegisterAction("/page", func(ctx Ctx) error {
+		return ctx.Send([]byte(fmt.Sprintf("render %d", atomic.AddInt32(&calls, 1))))
+	})
+	mod.RegisterAction("/nonce", func(ctx Ctx) error {
+		return ctx.Send([]byte(fmt.Sprintf("render %d", atomic.AddInt32(&calls, 1))))
+	})
+	mod.SetRouteConfig("/nonce", RouteConfig{Security: &SecurityPolicy{
+		ContentSecurityPolicy: "script-src 'nonce-{nonce}'",
+	}})
+
+	srv := NewService()
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		setup func(r *http.Request)
+	}{
+		{"authorization", "/page/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }},
+		{"session cookie", "/page/", func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: srv.Config.CookieKeySession, Value: "id"})
+		}},
+		{"token cookie", "/page/", func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: srv.Config.CookieKeyToken, Value: "token"})
+		}},
+		{"csp nonce", "/nonce/", func(r *http.Request) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest("GET", tt.path, nil)
+				tt.setup(req)
+				rec := httptest.NewRecorder()
+				h, urlPath, _ := srv.router.find(req)
+				h.handle(rec, req, urlPath, urlPath, time.Now())
+				bodies = append(bodies, rec.Body.String())
+			}
+			if bodies[0] == bodies[1] {
+				t.Errorf("expected no cached response, got %q twice", bodies[0])
+			}
+		})
+	}
+
+	// an anonymous request of the same page is cached
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/page/", nil)
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		bodies = append(bodies, rec.Body.String())
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("expected a cache hit, got %q and %q", bodies[0], bodies[1])
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+
+	tests := []struct {
+		name string
+		vary []string
+		want []string
+	}{
+		{"not keyed", nil, []string{"json 1", "text 2", "json 3"}},
+		{"keyed", []string{"accept"}, []string{"json 1", "text 2", "json 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var calls int32
+
+			cache := NewResponseCache(time.Minute, 16)
+			cache.Vary = tt.vary
+
+			mod := NewModule()
+			mod.Config.Filters = []Filter{cache.Filter}
+			mod.RegisterAction("/page", func(ctx Ctx) error {
+				n := atomic.AddInt32(&calls, 1)
+				return ctx.Negotiate(
+					Offer{"application/json", func() error { return ctx.Send([]byte(fmt.Sprintf("json %d", n))) }},
+					Offer{"text/plain", func() error { return ctx.Send([]byte(fmt.Sprintf("text %d", n))) }},
+				)
+			})
+
+			srv := NewService()
+			srv.HandleModule("/", mod)
+			for _, h := range srv.handlers {
+				srv.router.add(h.pattern, h)
+			}
+
+			for i, accept := range []string{"application/json", "text/plain", "application/json"} {
+				req := httptest.NewRequest("GET", "/page/", nil)
+				req.Header.Set("Accept", accept)
+				rec := httptest.NewRecorder()
+				h, urlPath, _ := srv.router.find(req)
+				h.handle(rec, req, urlPath, urlPath, time.Now())
+				if rec.Body.String() != tt.want[i] {
+					t.Errorf("%s: expected %q, got %q", accept, tt.want[i], rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Decoder decodes the body of req into v.
+type Decoder func(req *Request, v any) error
+
+// DecodeError is a malformed request body, answered with a 400.
+type DecodeError struct {
+	ContentType string
+	Err         error
+}
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	decoderMu sync.RWMutex
+	decoders  = map[string]Decoder{
+		"application/json":                  decodeJSON,
+		"application/xml":                   decodeXML,
+		"text/xml":                          decodeXML,
+		"application/x-www-form-urlencoded": decodeForm,
+		"multipart/form-data":               decodeForm,
+	}
+)
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid %s body: %v", e.ContentType, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// RegisterDecoder sets the decoder of a content type, such as msgpack, CBOR
+// or protobuf, a nil fn removes it, e.g.
+//
+//	httpsrv.RegisterDecoder("application/msgpack", func(req *httpsrv.Request, v any) error {
+//		return msgpack.NewDecoder(req.Body).Decode(v)
+//	})
+//
+// The types without a decoder of their own use the one of their suffix, e.g.
+// "application/vnd.api+json" the JSON decoder.
+func RegisterDecoder(contentType string, fn Decoder) {
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
+	contentType = strings.ToLower(contentType)
+	if fn == nil {
+		delete(decoders, contentType)
+	} else {
+		decoders[contentType] = fn
+	}
+}
+
+func lookupDecoder(contentType string) Decoder {
+	decoderMu.RLock()
+	defer decoderMu.RUnlock()
+	if fn, ok := decoders[contentType]; ok {
+		return fn
+	}
+	if i := strings.LastIndexByte(contentType, '+'); i > 0 {
+		return decoders["application/"+contentType[i+1:]]
+	}
+	return nil
+}
+
+// Decode decodes the body of the request into v with the decoder of its
+// Content-Type: JSON, XML, a urlencoded or multipart form, or one added by
+// RegisterDecoder. The forms fill a struct like Params.Bind from the form
+// values only, or a *url.Values, *map[string]string or *map[string]any (see
+// Params.Nested).
+//
+// An unknown type gives an ErrUnsupportedMediaType, and a malformed body a
+// *DecodeError, which Controller.RenderFieldErrors answers with a 415 and a
+// 400.
+func (req *Request) Decode(v any) error {
+
+	fn := lookupDecoder(req.ContentType)
+	if fn == nil {
+		return fmt.Errorf("%w %s", ErrUnsupportedMediaType, req.ContentType)
+	}
+
+	err := fn(req, v)
+	if req.bodyErr != nil {
+		return req.bodyErr
+	}
+	if err != nil {
+		var fes FieldErrors
+		if errors.Is(err, ErrBindTarget) || errors.As(err, &fes) {
+			return err
+		}
+		return &DecodeError{
+			ContentType: req.ContentType,
+			Err:         err,
+		}
+	}
+
+	return nil
+}
+
+// The streamed bodies are decoded as they are read.
+func decodeJSON(req *Request, v any) error {
+	if req.streamBody {
+		return json.NewDecoder(req.BodyReader(nil)).Decode(v)
+	}
+	return jsonDecode(req.RawBody(), v)
+}
+
+func decodeXML(req *Request, v any) error {
+	if req.streamBody {
+		return xml.NewDecoder(req.BodyReader(nil)).Decode(v)
+	}
+	return xml.Unmarshal(req.RawBody(), v)
+}
+
+func decodeForm(req *Request, v any) error {
+
+	p := &Params{
+		request: req.Request,
+		req:     req,
+		source:  "form",
+	}
+	p.init()
+	if req.streamBody {
+		// A streamed form is read as a whole when it is decoded.
+		p.parseBody()
+	}
+	if req.bodyErr != nil {
+		return req.bodyErr
+	}
+
+	switch dst := v.(type) {
+
+	case *url.Values:
+		*dst = url.Values{}
+		for k, vs := range req.PostForm {
+			(*dst)[k] = append([]string(nil), vs...)
+		}
+		return nil
+
+	case *map[string]string:
+		*dst = map[string]string{}
+		for k, vs := range req.PostForm {
+			if len(vs) > 0 {
+				(*dst)[k] = vs[0]
+			}
+		}
+		return nil
+
+	case *map[string]any:
+		*dst = p.Nested()
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+
+	var errs FieldErrors
+	if _, err := p.bindStruct(rv.Elem(), "", "form", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
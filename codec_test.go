@@ -0,0 +1,140 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type codecOrder struct {
+	ID   int    `json:"id" xml:"id" param:"id"`
+	Name string `json:"name" xml:"name" param:"name"`
+}
+
+func TestRequestDecode(t *testing.T) {
+
+	RegisterDecoder("text/csv", func(req *Request, v any) error {
+		id, name, _ := strings.Cut(string(req.RawBody()), ",")
+		o := v.(*codecOrder)
+		o.Name = name
+		return jsonDecode([]byte(id), &o.ID)
+	})
+	t.Cleanup(func() {
+		RegisterDecoder("text/csv", nil)
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        codecOrder
+		err         error
+	}{
+		{"json", "application/json", `{"id":1,"name":"a"}`, codecOrder{1, "a"}, nil},
+		{"json suffix", "application/vnd.api+json; charset=utf-8", `{"id":2,"name":"b"}`, codecOrder{2, "b"}, nil},
+		{"xml", "application/xml", `<order><id>3</id><name>c</name></order>`, codecOrder{3, "c"}, nil},
+		{"text xml", "text/xml", `<order><id>4</id><name>d</name></order>`, codecOrder{4, "d"}, nil},
+		{"form", "application/x-www-form-urlencoded", "id=5&name=e", codecOrder{5, "e"}, nil},
+		{"registered", "text/csv", "6,f", codecOrder{6, "f"}, nil},
+		{"malformed", "application/json", `{"id":`, codecOrder{}, &DecodeError{}},
+		{"unsupported", "application/yaml", "id: 7", codecOrder{}, ErrUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			var v codecOrder
+			err := newRequest(r).Decode(&v)
+
+			var de *DecodeError
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tt.err == ErrUnsupportedMediaType && !errors.Is(err, ErrUnsupportedMediaType):
+				t.Fatalf("expected ErrUnsupportedMediaType, got %v", err)
+			case tt.err != nil && tt.err != ErrUnsupportedMediaType && !errors.As(err, &de):
+				t.Fatalf("expected a DecodeError, got %v", err)
+			}
+			if v != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, v)
+			}
+		})
+	}
+}
+
+func TestRequestDecodeForm(t *testing.T) {
+
+	body := "user[name]=x&user[tags][]=a&tag=b"
+	newReq := func() *Request {
+		r := httptest.NewRequest("POST", "/?tag=q", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return newRequest(r)
+	}
+
+	var vs url.Values
+	if err := newReq().Decode(&vs); err != nil || vs.Get("tag") != "b" || len(vs["tag"]) != 1 {
+		t.Errorf("unexpected values %v, err %v", vs, err)
+	}
+
+	var m map[string]any
+	if err := newReq().Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := m["user"].(map[string]any); user == nil || user["name"] != "x" {
+		t.Errorf("unexpected nested values %v", m)
+	}
+
+	var n int
+	if err := newReq().Decode(&n); err != ErrBindTarget {
+		t.Errorf("expected ErrBindTarget, got %v", err)
+	}
+}
+
+func TestRenderDecodeErrors(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"malformed", "application/xml", "<order>", http.StatusBadRequest},
+		{"unsupported", "application/yaml", "id: 1", http.StatusUnsupportedMediaType},
+		{"conversion", "application/x-www-form-urlencoded", "id=x", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			c := newController(nil, newRequest(r), newResponse(httptest.NewRecorder()))
+
+			var v codecOrder
+			c.RenderFieldErrors(c.Request.Decode(&v))
+			if c.Response.Status != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, c.Response.Status)
+			}
+		})
+	}
+}
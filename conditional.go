@@ -0,0 +1,113 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetETag sets the ETag of the response, and reports whether the copy of the
+// client is still fresh. In that case the response is a 304 Not Modified and
+// the action should return without rendering, e.g.
+//
+//	if c.SetETag(strconv.FormatInt(doc.Version, 10)) {
+//		return
+//	}
+func (c *Controller) SetETag(etag string) bool {
+	if etag == "" {
+		return false
+	}
+	if etag[0] != '"' && !strings.HasPrefix(etag, `W/"`) {
+		etag = `"` + etag + `"`
+	}
+	c.Response.Header().Set("ETag", etag)
+	return c.checkNotModified()
+}
+
+// SetLastModified sets the Last-Modified time of the response, and reports
+// whether the copy of the client is still fresh, see SetETag.
+func (c *Controller) SetLastModified(t time.Time) bool {
+	if t.IsZero() || t.Unix() == 0 {
+		return false
+	}
+	c.Response.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	return c.checkNotModified()
+}
+
+func (c *Controller) checkNotModified() bool {
+	if !requestNotModified(c.Request.Request, c.Response.Header()) {
+		return false
+	}
+	c.AutoRender = false
+	c.Response.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// requestNotModified evaluates the If-None-Match and If-Modified-Since
+// preconditions of a GET or HEAD request against the validators of the
+// response (RFC 7232). If-None-Match takes precedence.
+func requestNotModified(r *http.Request, h http.Header) bool {
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			if v = strings.TrimSpace(v); v == "*" || etagWeakMatch(v, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		lm, err := http.ParseTime(h.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+		t, err := http.ParseTime(ims)
+		return err == nil && !lm.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// autoETag sets a strong ETag computed from the buffered body of a
+// successful GET or HEAD response, and reports whether it did.
+func (resp *Response) autoETag(r *http.Request) bool {
+
+	if (r.Method != "GET" && r.Method != "HEAD") ||
+		(resp.Status != 0 && resp.Status != http.StatusOK) ||
+		resp.buf.Len() == 0 || resp.Header().Get("ETag") != "" {
+		return false
+	}
+
+	resp.Header().Set("ETag", `"`+strconv.FormatUint(crc64Checksum(resp.buf.Bytes()), 36)+
+		"-"+strconv.Itoa(resp.buf.Len())+`"`)
+
+	return true
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAutoETag(t *testing.T) {
+	srv := NewService()
+	srv.Config.AutoETag = true
+
+	srv.regHandler(&regHandler{
+		pattern: "/page",
+		handlerAction: &handlerAction{
+			name: "Page",
+			fn: func(ctx Ctx) error {
+				return ctx.JSON(map[string]string{"title": "landing"})
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	req := httptest.NewRequest("GET", "/page/", nil)
+	rec := httptest.NewRecorder()
+
+	h, urlPath, _ := srv.router.find(req)
+	h.handle(rec, req, urlPath, urlPath, time.Now())
+
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an etag, got %d %q", rec.Code, etag)
+	}
+
+	req = httptest.NewRequest("GET", "/page/", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	rec = httptest.NewRecorder()
+
+	h.handle(rec, req, urlPath, urlPath, time.Now())
+
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("expected 304 without body, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("expected etag %q on 304, got %q", etag, rec.Header().Get("ETag"))
+	}
+}
+
+func TestControllerSetETagLastModified(t *testing.T) {
+
+	modTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		fresh   bool
+	}{
+		{"no precondition", nil, false},
+		{"etag match", map[string]string{"If-None-Match": `W/"v42"`}, true},
+		{"etag mismatch", map[string]string{"If-None-Match": `"v41"`}, false},
+		{"modified since", map[string]string{"If-Modified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)}, false},
+		{"not modified since", map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, true},
+		{"etag precedence", map[string]string{"If-None-Match": `"v41"`, "If-Modified-Since": modTime.Format(http.TimeFormat)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/doc", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			c := newController(nil, newRequest(r), newResponse(httptest.NewRecorder()))
+
+			c.SetLastModified(modTime)
+			fresh := c.SetETag("v42")
+
+			if fresh != tt.fresh {
+				t.Errorf("expected fresh %v, got %v", tt.fresh, fresh)
+			}
+			if fresh && c.Response.Status != http.StatusNotModified {
+				t.Errorf("expected status 304, got %d", c.Response.Status)
+			}
+		})
+	}
+}
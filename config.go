@@ -25,12 +25,53 @@ type Config struct {
 
 	HttpTimeout uint16 `json:"http_timeout,omitempty" toml:"http_timeout,omitempty"`
 
+	// Timeouts of the http server in seconds, each one defaults to HttpTimeout.
+	// The write timeout must cover the longest RouteConfig.Timeout.
+	HttpReadHeaderTimeout uint16 `json:"http_read_header_timeout,omitempty" toml:"http_read_header_timeout,omitempty"`
+	HttpReadTimeout       uint16 `json:"http_read_timeout,omitempty" toml:"http_read_timeout,omitempty"`
+	HttpWriteTimeout      uint16 `json:"http_write_timeout,omitempty" toml:"http_write_timeout,omitempty"`
+	HttpIdleTimeout       uint16 `json:"http_idle_timeout,omitempty" toml:"http_idle_timeout,omitempty"`
+
 	UrlBasePath string `json:"url_base_path,omitempty" toml:"url_base_path,omitempty"`
 
 	CookieKeyLocale  string `json:"cookie_key_locale,omitempty" toml:"cookie_key_locale,omitempty"`
 	CookieKeySession string `json:"cookie_key_session,omitempty" toml:"cookie_key_session,omitempty"`
 
+	// Name of the cookie holding the token read by JWTAuthenticator.
+	CookieKeyToken string `json:"cookie_key_token,omitempty" toml:"cookie_key_token,omitempty"`
+
 	CompressResponse bool `json:"compress_response,omitempty" toml:"compress_response,omitempty"`
+
+	// Set an ETag computed from the body of the rendered GET/HEAD responses,
+	// and reply 304 Not Modified when it matches If-None-Match.
+	AutoETag bool `json:"auto_etag,omitempty" toml:"auto_etag,omitempty"`
+
+	// IP addresses or CIDR blocks of the reverse proxies whose forwarding
+	// headers (Forwarded, X-Forwarded-For/Proto/Host, X-Real-IP) are trusted,
+	// e.g. ["127.0.0.1", "10.0.0.0/8", "unix"]
+	TrustedProxies []string `json:"trusted_proxies,omitempty" toml:"trusted_proxies,omitempty"`
+
+	// Security headers of the responses, e.g. &DefaultSecurityPolicy
+	Security *SecurityPolicy `json:"security,omitempty" toml:"security,omitempty"`
+
+	// Maximum size in bytes of a request body, 0 means no limit.
+	MaxBodySize int64 `json:"max_body_size,omitempty" toml:"max_body_size,omitempty"`
+
+	// Maximum bytes of a multipart form kept in memory, the remaining file
+	// parts are stored in temporary files. Defaults to 32 MB.
+	MaxMultipartMemory int64 `json:"max_multipart_memory,omitempty" toml:"max_multipart_memory,omitempty"`
+
+	// Maximum size in bytes of each uploaded file, 0 means no limit.
+	MaxFileSize int64 `json:"max_file_size,omitempty" toml:"max_file_size,omitempty"`
+
+	// Decode the request bodies compressed with gzip, br or deflate, the
+	// other encodings get a 415.
+	DecompressRequest bool `json:"decompress_request,omitempty" toml:"decompress_request,omitempty"`
+
+	// Maximum size in bytes of a decompressed request body, 32 MB by
+	// default. When it is 0 the limit is MaxBodySize, or 32 MB without one,
+	// and a negative value disables it.
+	MaxDecompressedSize int64 `json:"max_decompressed_size,omitempty" toml:"max_decompressed_size,omitempty"`
 }
 
 var DefaultConfig = Config{
@@ -42,6 +83,89 @@ var DefaultConfig = Config{
 
 	CookieKeyLocale:  "lang",
 	CookieKeySession: "access_token",
+	CookieKeyToken:   "auth_token",
+
+	MaxBodySize:         32 << 20, // 32 MB
+	MaxMultipartMemory:  32 << 20, // 32 MB
+	MaxDecompressedSize: 32 << 20, // 32 MB
+}
+
+// RouteConfig holds the settings which may be customized for all the routes
+// of a module (Module.Config) or for a single route (Module.SetRouteConfig).
+type RouteConfig struct {
+	// Filters run after the service filters, module filters first.
+	Filters []Filter `json:"-" toml:"-"`
+
+	// Replaces Config.Security, an empty policy sends no security headers.
+	Security *SecurityPolicy `json:"security,omitempty" toml:"security,omitempty"`
+
+	// Replace the limits of Config, a negative value disables a limit.
+	MaxBodySize         int64 `json:"max_body_size,omitempty" toml:"max_body_size,omitempty"`
+	MaxMultipartMemory  int64 `json:"max_multipart_memory,omitempty" toml:"max_multipart_memory,omitempty"`
+	MaxFileSize         int64 `json:"max_file_size,omitempty" toml:"max_file_size,omitempty"`
+	MaxDecompressedSize int64 `json:"max_decompressed_size,omitempty" toml:"max_decompressed_size,omitempty"`
+
+	// StreamBody leaves the request body to the handler, which reads it with
+	// Request.BodyReader, Request.MultipartStream or Request.Decode: nothing
+	// is buffered, RawBody is empty and Params holds no form values.
+	StreamBody bool `json:"stream_body,omitempty" toml:"stream_body,omitempty"`
+
+	// Deadline of the handler in seconds, set on the request context. When
+	// it is exceeded the client gets TimeoutStatus (default 503) and
+	// TimeoutBody.
+	Timeout       uint16 `json:"timeout,omitempty" toml:"timeout,omitempty"`
+	TimeoutStatus int    `json:"timeout_status,omitempty" toml:"timeout_status,omitempty"`
+	TimeoutBody   string `json:"timeout_body,omitempty" toml:"timeout_body,omitempty"`
+
+	// Limiter caps the requests in flight of the route, in addition to
+	// Service.Limiter. Priority is the admission class of its requests.
+	Limiter  *ConcurrencyLimiter `json:"-" toml:"-"`
+	Priority Priority            `json:"priority,omitempty" toml:"priority,omitempty"`
+}
+
+// merge returns the settings of c overridden by the non-zero settings of o.
+func (c *RouteConfig) merge(o *RouteConfig) *RouteConfig {
+	cfg := *c
+	if o == nil {
+		return &cfg
+	}
+	if len(o.Filters) > 0 {
+		cfg.Filters = append(append([]Filter{}, c.Filters...), o.Filters...)
+	}
+	if o.Security != nil {
+		cfg.Security = o.Security
+	}
+	if o.MaxBodySize != 0 {
+		cfg.MaxBodySize = o.MaxBodySize
+	}
+	if o.MaxMultipartMemory != 0 {
+		cfg.MaxMultipartMemory = o.MaxMultipartMemory
+	}
+	if o.MaxFileSize != 0 {
+		cfg.MaxFileSize = o.MaxFileSize
+	}
+	if o.MaxDecompressedSize != 0 {
+		cfg.MaxDecompressedSize = o.MaxDecompressedSize
+	}
+	if o.StreamBody {
+		cfg.StreamBody = true
+	}
+	if o.Timeout != 0 {
+		cfg.Timeout = o.Timeout
+	}
+	if o.TimeoutStatus != 0 {
+		cfg.TimeoutStatus = o.TimeoutStatus
+	}
+	if o.TimeoutBody != "" {
+		cfg.TimeoutBody = o.TimeoutBody
+	}
+	if o.Limiter != nil {
+		cfg.Limiter = o.Limiter
+	}
+	if o.Priority != PriorityNormal {
+		cfg.Priority = o.Priority
+	}
+	return &cfg
 }
 
 func (c *Config) RegisterTemplateFunc(name string, fn interface{}) {
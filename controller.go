@@ -27,12 +27,16 @@ type Controller struct {
 	ActionName string // The action name, e.g. "Index"
 	Request    *Request
 	Response   *Response
-	Params     *Params  // Parameters from URL and form (including multipart).
-	Session    *Session // Session, stored in cookie, signed.
+	Params     *Params    // Parameters from URL and form (including multipart).
+	Session    *Session   // Session, stored by Service.Sessions.
+	User       *Principal // Authenticated principal, set by AuthFilter.
 	AutoRender bool
 	Data       map[string]interface{}
 	modPath    string
 	service    *Service
+
+	authChallenges []string
+	cacheTags      []string
 }
 
 type handlerController struct {
@@ -63,6 +67,7 @@ func newController(srv *Service, req *Request, resp *Response) *Controller {
 
 func (c *Controller) RenderHTML(htm string) {
 	c.AutoRender = false
+	c.Session.templateData(c.Data)
 
 	defer func() {
 		if err := recover(); err != nil {
@@ -91,6 +96,7 @@ func (c *Controller) RenderHTML(htm string) {
 func (c *Controller) Render(args ...interface{}) {
 
 	c.AutoRender = false
+	c.Session.templateData(c.Data)
 
 	modPath, templatePath := c.modPath, c.Name+"/"+c.ActionName+".tpl"
 
@@ -134,18 +140,13 @@ func (c *Controller) Render(args ...interface{}) {
 func (c *Controller) RenderError(status int, msg string) {
 	c.AutoRender = false
 	c.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
-	c.Response.Out.WriteHeader(status)
-	c.Response.Out.Write([]byte(msg))
+	c.Response.WriteHeader(status)
+	c.Response.Write([]byte(msg))
 }
 
 func (c *Controller) UrlBase(path string) string {
 
-	urlBase := ""
-	if c.Request.TLS != nil {
-		urlBase = "https://" + c.Request.Host
-	} else {
-		urlBase = "http://" + c.Request.Host
-	}
+	urlBase := c.Request.Scheme() + "://" + c.Request.Host
 
 	if c.service != nil && c.service.Config.UrlBasePath != "" {
 		urlBase += "/" + c.service.Config.UrlBasePath
@@ -177,14 +178,20 @@ func (c *Controller) Redirect(url string) {
 	if url[0] != '/' && !strings.HasPrefix(url, "http") {
 
 		if c.service != nil && c.service.Config.UrlBasePath != "" {
-			c.Response.Header().Set("Location", "/"+c.service.Config.UrlBasePath+"/"+url)
+			url = "/" + c.service.Config.UrlBasePath + "/" + url
 		} else {
-			c.Response.Header().Set("Location", "/"+url)
+			url = "/" + url
 		}
-	} else {
-		c.Response.Header().Set("Location", url)
 	}
 
+	// Build the absolute location with the scheme and host seen by the client,
+	// when a trusted proxy reported ones different from the local ones.
+	if c.Request.forwardedOrigin && url[0] == '/' && (len(url) == 1 || url[1] != '/') && c.Request.Host != "" {
+		url = c.Request.Scheme() + "://" + c.Request.Host + url
+	}
+
+	c.Response.Header().Set("Location", url)
+
 	c.Response.WriteHeader(http.StatusFound)
 }
 
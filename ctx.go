@@ -14,6 +14,10 @@
 
 package httpsrv
 
+import (
+	"net/http"
+)
+
 type Ctx interface {
 	Request() *Request
 
@@ -25,13 +29,30 @@ type Ctx interface {
 
 	Params() *Params
 
+	// Bind fills the struct dst from the request, see Params.Bind.
+	Bind(dst any) error
+
+	// User returns the authenticated principal, see Controller.User, or nil.
+	User() *Principal
+
 	Status(status int) Ctx
 
 	JSON(data any) error
 
+	// Negotiate runs the offer of the media type preferred by the Accept
+	// header, the first one of equal quality, see Request.Accepts, or
+	// answers 406 Not Acceptable.
+	Negotiate(offers ...Offer) error
+
 	Send(body []byte) error
 }
 
+// Offer is a representation of a response of Ctx.Negotiate.
+type Offer struct {
+	Type   string // media type, e.g. "application/json"
+	Render func() error
+}
+
 type ctxImpl struct {
 	c *Controller
 }
@@ -60,6 +81,14 @@ func (it *ctxImpl) Params() *Params {
 	return it.c.Params
 }
 
+func (it *ctxImpl) Bind(dst any) error {
+	return it.c.Params.Bind(dst)
+}
+
+func (it *ctxImpl) User() *Principal {
+	return it.c.User
+}
+
 func (it *ctxImpl) Status(status int) Ctx {
 	it.c.Response.Status = status
 	return it
@@ -70,7 +99,28 @@ func (it *ctxImpl) JSON(data any) error {
 	return nil
 }
 
-func (it *ctxImpl) Send(body []byte) error {
-	it.c.Response.buf.Write(body)
+func (it *ctxImpl) Negotiate(offers ...Offer) error {
+
+	types := make([]string, len(offers))
+	for i, o := range offers {
+		types[i] = o.Type
+	}
+
+	it.c.Response.Header().Add("Vary", "Accept")
+
+	if typ := it.c.Request.Accepts(types...); typ != "" {
+		for _, o := range offers {
+			if o.Type == typ {
+				return o.Render()
+			}
+		}
+	}
+
+	it.c.RenderError(http.StatusNotAcceptable, "406 Not Acceptable")
 	return nil
 }
+
+func (it *ctxImpl) Send(body []byte) error {
+	_, err := it.c.Response.Write(body)
+	return err
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ErrUnsupportedEncoding is the error of a request body with a
+// Content-Encoding other than gzip, br and deflate, answered with a 415.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// defaultMaxDecompressedSize limits the decompressed bodies of the routes
+// without any size limit.
+const defaultMaxDecompressedSize = 32 << 20 // 32 MB
+
+// decompressReader decodes a request body on first read, and fails with a
+// *http.MaxBytesError past limit decoded bytes.
+type decompressReader struct {
+	body     io.ReadCloser
+	encoding string
+	r        io.Reader
+	limit    int64
+	read     int64
+	err      error
+}
+
+// decompressBody replaces a compressed body of r with its decoded content,
+// and removes the Content-Encoding and Content-Length of the request.
+func decompressBody(r *http.Request, limit int64) error {
+
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip", "br", "deflate":
+	default:
+		return ErrUnsupportedEncoding
+	}
+
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	r.Body = &decompressReader{
+		body:     r.Body,
+		encoding: encoding,
+		limit:    limit,
+	}
+	return nil
+}
+
+func (dr *decompressReader) Read(b []byte) (int, error) {
+
+	if dr.err != nil {
+		return 0, dr.err
+	}
+
+	if dr.r == nil {
+		switch dr.encoding {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(dr.body)
+			if err != nil {
+				dr.err = err
+				return 0, err
+			}
+			dr.r = zr
+		case "br":
+			dr.r = brotli.NewReader(dr.body)
+		case "deflate":
+			zr, err := newDeflateReader(dr.body)
+			if err != nil {
+				dr.err = err
+				return 0, err
+			}
+			dr.r = zr
+		}
+	}
+
+	n, err := dr.r.Read(b)
+	if dr.read += int64(n); dr.limit > 0 && dr.read > dr.limit {
+		dr.err = &http.MaxBytesError{Limit: dr.limit}
+		return 0, dr.err
+	}
+	if err != nil {
+		dr.err = err
+	}
+	return n, err
+}
+
+func (dr *decompressReader) Close() error {
+	if rc, ok := dr.r.(io.Closer); ok {
+		rc.Close()
+	}
+	return dr.body.Close()
+}
+
+// newDeflateReader reads the zlib streams of the deflate encoding, and the
+// raw deflate streams sent by some clients.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
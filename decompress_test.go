@@ -0,0 +1,172 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func compressTestBody(encoding, s string) []byte {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return []byte(s)
+	}
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressRequest(t *testing.T) {
+
+	mod := NewModule()
+	mod.RegisterAction("/echo", func(ctx Ctx) error {
+		return ctx.Send(ctx.Body())
+	})
+	mod.RegisterAction("/form", func(ctx Ctx) error {
+		return ctx.Send([]byte(ctx.Params().Value("name")))
+	})
+
+	srv := NewService()
+	srv.Config.DecompressRequest = true
+	srv.Config.MaxBodySize = 1 << 10
+	srv.Config.MaxDecompressedSize = 64
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		encoding string
+		header   string
+		body     string
+		status   int
+		want     string
+	}{
+		{"gzip", "/echo/", "gzip", "gzip", "hello gzip", http.StatusOK, "hello gzip"},
+		{"brotli", "/echo/", "br", "br", "hello br", http.StatusOK, "hello br"},
+		{"deflate", "/echo/", "deflate", "deflate", "hello deflate", http.StatusOK, "hello deflate"},
+		{"raw deflate", "/echo/", "raw deflate", "deflate", "hello raw", http.StatusOK, "hello raw"},
+		{"identity", "/echo/", "", "identity", "plain", http.StatusOK, "plain"},
+		{"form", "/form/", "gzip", "gzip", "name=alice", http.StatusOK, "alice"},
+		{"unsupported", "/echo/", "", "zstd", "data", http.StatusUnsupportedMediaType, ""},
+		{"over decompressed limit", "/echo/", "gzip", "gzip", strings.Repeat("x", 1<<12), http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			req := httptest.NewRequest("POST", tt.path, bytes.NewReader(compressTestBody(tt.encoding, tt.body)))
+			req.Header.Set("Content-Encoding", tt.header)
+			if tt.path == "/form/" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			rec := httptest.NewRecorder()
+
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.want {
+				t.Errorf("expected body %q, got %q", tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		srv.Config.DecompressRequest = false
+		defer func() { srv.Config.DecompressRequest = true }()
+
+		body := compressTestBody("gzip", "hello")
+		req := httptest.NewRequest("POST", "/echo/", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if !bytes.Equal(rec.Body.Bytes(), body) {
+			t.Errorf("expected the compressed body, got %q", rec.Body.String())
+		}
+	})
+}
+
+func TestDecompressRequestDefaultLimit(t *testing.T) {
+
+	bomb := compressTestBody("gzip", strings.Repeat("\x00", 40<<20))
+
+	tests := []struct {
+		name  string
+		setup func(cfg *Config)
+	}{
+		{"default config", func(cfg *Config) {}},
+		{"no size limits", func(cfg *Config) { cfg.MaxBodySize, cfg.MaxDecompressedSize = 0, 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			mod := NewModule()
+			mod.RegisterAction("/echo", func(ctx Ctx) error {
+				return ctx.Send(ctx.Body())
+			})
+
+			srv := NewService()
+			srv.Config.DecompressRequest = true
+			tt.setup(&srv.Config)
+			srv.HandleModule("/", mod)
+			for _, h := range srv.handlers {
+				srv.router.add(h.pattern, h)
+			}
+
+			req := httptest.NewRequest("POST", "/echo/", bytes.NewReader(bomb))
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("expected 413 for a %d bytes zip bomb, got %d", len(bomb), rec.Code)
+			}
+		})
+	}
+}
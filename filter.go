@@ -14,6 +14,21 @@
 
 package httpsrv
 
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestFilter runs on the raw request before it is routed.
+// See Service.RequestFilters.
+type RequestFilter func(r *http.Request)
+
+// Filter runs before the action of every request it applies to.
+// If a filter sets the response status (e.g. through Controller.RenderError
+// or Controller.Redirect), the remaining filters and the action are skipped.
 type Filter func(c *Controller)
 
 // Filters is the default set of global filters.
@@ -23,3 +38,66 @@ var DefaultFilters = []Filter{
 	SessionFilter, // Restore and write the session cookie.
 	I18nFilter,    // Resolve the requested language.
 }
+
+// runFilters runs the filters in order, and reports whether the request was
+// answered by one of them.
+func (c *Controller) runFilters(filters []Filter) bool {
+	for _, filter := range filters {
+		if filter(c); c.Response.Status != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// methodOverrideMaxPeek is the maximum size of a form body read to find the
+// _method field, larger bodies are left untouched.
+const methodOverrideMaxPeek = 1 << 20
+
+// MethodOverrideFilter turns a POST request into a PUT, PATCH or DELETE one
+// as set by the X-HTTP-Method-Override header, or else the "_method" field of
+// an urlencoded form, so HTML forms can reach resource-style actions, e.g.
+//
+//	srv.RequestFilters = append(srv.RequestFilters, httpsrv.MethodOverrideFilter)
+//
+// A "_method" in the query string is ignored: the override must come from the
+// form being posted, not from the URL it is posted to.
+func MethodOverrideFilter(r *http.Request) {
+
+	if r.Method != "POST" {
+		return
+	}
+
+	var (
+		method = r.Header.Get("X-HTTP-Method-Override")
+		form   url.Values
+	)
+
+	if r.Body != nil && r.Body != http.NoBody &&
+		resolveContentType(r) == "application/x-www-form-urlencoded" {
+
+		// Read the body ahead and restore it for the handler.
+		var buf bytes.Buffer
+		n, err := io.Copy(&buf, io.LimitReader(r.Body, methodOverrideMaxPeek+1))
+		if err == nil && n <= methodOverrideMaxPeek {
+			if form, err = url.ParseQuery(buf.String()); err == nil && method == "" {
+				method = form.Get("_method")
+			}
+			r.Body = io.NopCloser(&buf)
+		} else {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(&buf, r.Body), r.Body}
+		}
+	}
+
+	switch method = strings.ToUpper(strings.TrimSpace(method)); method {
+	case "PUT", "PATCH", "DELETE":
+		r.Method = method
+		// net/http only parses the form bodies of POST, PUT and PATCH requests.
+		if form != nil {
+			r.PostForm = form
+		}
+	}
+}
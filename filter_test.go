@@ -0,0 +1,71 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMethodOverrideFilter(t *testing.T) {
+
+	srv := NewService()
+	srv.RequestFilters = append(srv.RequestFilters, MethodOverrideFilter)
+
+	srv.regHandler(&regHandler{
+		pattern: "/doc",
+		handlerAction: &handlerAction{
+			name: "Doc",
+			fn: func(ctx Ctx) error {
+				return ctx.Send([]byte(ctx.Request().Method + " " + ctx.Params().Value("title")))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		headers map[string]string
+		want    string
+	}{
+		{"form field", "POST", "/doc/", "_method=delete&title=a", nil, "DELETE a"},
+		{"query", "POST", "/doc/?_method=PATCH", "title=b", nil, "POST b"},
+		{"header", "POST", "/doc/", "title=c", map[string]string{"X-HTTP-Method-Override": "PUT"}, "PUT c"},
+		{"not allowed", "POST", "/doc/", "_method=GET&title=d", nil, "POST d"},
+		{"not a post", "GET", "/doc/?_method=DELETE&title=e", "", nil, "GET e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			(&rootHandler{srv}).ServeHTTP(rec, req)
+
+			if rec.Body.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, rec.Body.String())
+			}
+		})
+	}
+}
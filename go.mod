@@ -2,4 +2,7 @@ module github.com/hooto/httpsrv
 
 go 1.22
 
-require github.com/andybalholm/brotli v1.1.1
+require (
+	github.com/andybalholm/brotli v1.1.1
+	golang.org/x/crypto v0.31.0
+)
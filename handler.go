@@ -15,8 +15,11 @@
 package httpsrv
 
 import (
+	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -46,6 +49,8 @@ type regHandler struct {
 	handlerController *handlerController
 	handlerModuler    *handlerModuler
 	handlerFileServer *handlerFileServer
+
+	config *RouteConfig
 }
 
 type handlerFileServer struct {
@@ -54,14 +59,29 @@ type handlerFileServer struct {
 }
 
 type handlerModuler struct {
-	mu      sync.RWMutex
-	actions map[string]*handlerController
+	mu        sync.RWMutex
+	actions   map[string]*handlerController
+	configs   map[string]*RouteConfig
+	modConfig *RouteConfig // of the module, for the unknown actions
 }
 
 type rootHandler struct {
 	service *Service
 }
 
+// timeoutWriter holds the output of a handler running with a deadline.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+
+	// The flushes of a streamed response write to w, see Flush.
+	w         http.ResponseWriter
+	committed bool
+}
+
 var genArgs = []reflect.Value{}
 
 var defaultHandlers = []*regHandler{
@@ -75,6 +95,9 @@ var defaultHandlers = []*regHandler{
 
 func (it *rootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqTime := time.Now()
+	for _, filter := range it.service.RequestFilters {
+		filter(r)
+	}
 	h, urlPath, urlRoutePath := it.service.router.find(r)
 	h.handle(w, r, urlPath, urlRoutePath, reqTime)
 }
@@ -106,36 +129,211 @@ func (it *regHandler) handle(
 	urlPath, urlRoutePath string, reqTime time.Time,
 ) {
 
+	cfg := it.routeConfig(r)
+
+	release, ok := it.admit(w, r, cfg)
+	if !ok {
+		return
+	}
+
+	if cfg != nil && cfg.Timeout > 0 {
+		it.handleTimeout(w, r, cfg, urlPath, urlRoutePath, reqTime, release)
+		return
+	}
+
+	defer release()
+	it.serve(w, r, cfg, urlPath, urlRoutePath, reqTime)
+}
+
+// handleTimeout runs the route with a deadline set on the request context.
+// When the deadline is exceeded, the client gets the timeout response of the
+// route and the later output of the handler is discarded. The handler keeps
+// its limiter slots until it returns.
+func (it *regHandler) handleTimeout(
+	w http.ResponseWriter, r *http.Request, cfg *RouteConfig,
+	urlPath, urlRoutePath string, reqTime time.Time, release func(),
+) {
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
 	var (
-		req  = newRequest(r)
+		tw        = &timeoutWriter{w: w, header: http.Header{}}
+		done      = make(chan struct{})
+		panicChan = make(chan interface{}, 1)
+	)
+
+	go func() {
+		defer release()
+		defer func() {
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		it.serve(tw, r.WithContext(ctx), cfg, urlPath, urlRoutePath, reqTime)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicChan:
+		slog.Error("httpsrv handler panic", "path", urlPath, "panic", p)
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		if !tw.committed {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.commit()
+		w.Write(tw.buf.Bytes())
+
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+
+		// The client is gone, there is nobody to answer.
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+
+		// A streamed response is cut where it is.
+		if tw.committed {
+			slog.Warn("httpsrv handler timeout", "path", urlPath, "timeout", timeout)
+			return
+		}
+
+		status, body := cfg.TimeoutStatus, cfg.TimeoutBody
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		if body == "" {
+			body = strconv.Itoa(status) + " " + http.StatusText(status)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+		slog.Warn("httpsrv handler timeout", "path", urlPath, "timeout", timeout)
+	}
+}
+
+func (it *regHandler) serve(
+	w http.ResponseWriter, r *http.Request, cfg *RouteConfig,
+	urlPath, urlRoutePath string, reqTime time.Time,
+) {
+
+	var (
+		maxBody, maxMemory, maxFile = it.bodyLimits(cfg)
+		bodyErr                     error
+	)
+
+	// Reject the bodies over the limit before reading them, when the length is known.
+	if maxBody > 0 && r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > maxBody {
+			bodyErr = &http.MaxBytesError{Limit: maxBody}
+			r.Body = http.NoBody
+		} else {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		}
+	}
+
+	if bodyErr == nil && it.service != nil && it.service.Config.DecompressRequest {
+		if err := decompressBody(r, it.decompressLimit(cfg, maxBody)); err != nil {
+			bodyErr = err
+			r.Body = http.NoBody
+		}
+	}
+
+	var (
+		req  *Request
 		resp = newResponse(w)
 		ae   = r.Header.Get("Accept-Encoding")
 	)
 
+	if cfg != nil && cfg.StreamBody {
+		req = newStreamRequest(r)
+	} else {
+		req = newRequest(r)
+	}
+
+	req.service = it.service
+	req.maxMultipartMemory = maxMemory
+	req.maxFileSize = maxFile
+	if bodyErr != nil {
+		req.setBodyErr(bodyErr)
+	}
+
+	if it.service != nil {
+		req.resolveProxy(it.service.trustedProxies())
+	}
+
+	if cfg != nil && cfg.Security != nil {
+		cfg.Security.apply(w.Header(), req)
+	} else if it.service != nil && it.service.Config.Security != nil {
+		it.service.Config.Security.apply(w.Header(), req)
+	}
+
 	if it.service != nil && it.service.Config.CompressResponse && ae != "" {
-		if strings.Contains(ae, "gzip") {
-			resp.compWriter, ae = gzip.NewWriter(resp.buf), "gzip"
-		} else if strings.Contains(ae, "br") {
-			resp.compWriter, ae = brotli.NewWriterLevel(resp.buf, 5), "br"
+		switch ae = compressEncoding(ae); ae {
+		case "gzip":
+			resp.compWriter = gzip.NewWriter(resp.buf)
+		case "br":
+			resp.compWriter = brotli.NewWriterLevel(resp.buf, 5)
 		}
+		resp.compEncoding = ae
 	}
 
 	defer func() {
 
+		// The headers of a streamed response are already sent.
+		if resp.streaming {
+			if resp.compWriter != nil {
+				resp.compWriter.Close()
+			}
+			resp.drain()
+			return
+		}
+
+		if status := req.bodyStatus(); status != 0 {
+			resp.compWriter = nil
+			resp.buf.Reset()
+			resp.buf.WriteString(strconv.Itoa(status) + " " + http.StatusText(status))
+			resp.Status = status
+			w.Header().Del("Content-Encoding")
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+
 		if resp.compWriter != nil {
 			resp.compWriter.Flush()
 			resp.compWriter.Close()
 
 			if w.Header().Get("Content-Encoding") == "" && resp.buf.Len() > 0 {
-				switch ae {
-				case "gzip":
-					w.Header().Set("Content-Encoding", "gzip")
-				case "br":
-					w.Header().Set("Content-Encoding", "br")
-				}
+				w.Header().Set("Content-Encoding", resp.compEncoding)
+				w.Header().Add("Vary", "Accept-Encoding")
 			}
 		}
 
+		autoETag := it.service != nil && it.service.Config.AutoETag &&
+			it.handlerFileServer == nil && resp.autoETag(r)
+
+		for _, fn := range resp.commitHooks {
+			fn(resp.Status, w.Header(), resp.buf.Bytes())
+		}
+
+		if autoETag && requestNotModified(r, w.Header()) {
+			resp.Status = http.StatusNotModified
+		}
+
+		if resp.Status == http.StatusNotModified {
+			resp.buf.Reset()
+			w.Header().Del("Content-Encoding")
+			w.Header().Del("Content-Length")
+		}
+
 		if resp.buf != nil && resp.buf.Len() > 0 {
 			w.Header().Set("Content-Length", strconv.Itoa(resp.buf.Len()))
 			if resp.Status > 0 {
@@ -147,6 +345,29 @@ func (it *regHandler) handle(
 		}
 	}()
 
+	if req.bodyStatus() != 0 {
+		return
+	}
+
+	if it.service != nil && it.service.Maintenance != nil &&
+		it.service.Maintenance.serve(it.service, resp, req) {
+		return
+	}
+
+	req.Time = reqTime
+	req.urlPath = urlPath
+	req.urlRoutePath = urlRoutePath
+
+	// The file servers and the handler functions skip the service filters,
+	// which read the body, but the route filters, e.g. RequireAuth or an
+	// IPFilter, guard them as well.
+	if it.handlerFileServer != nil || it.handlerFunc != nil {
+		if cfg != nil && len(cfg.Filters) > 0 &&
+			newController(it.service, req, resp).runFilters(cfg.Filters) {
+			return
+		}
+	}
+
 	if it.handlerFileServer != nil {
 
 		if !strings.HasPrefix(urlPath, it.pattern) {
@@ -206,16 +427,31 @@ func (it *regHandler) handle(
 		return
 	}
 
-	var c = newController(it.service, req, resp)
+	var (
+		c                 = newController(it.service, req, resp)
+		handlerController = it.handlerController
+	)
 
-	req.Time = reqTime
-	req.urlPath = urlPath
-	req.urlRoutePath = urlRoutePath
+	if req.cspNonce != "" {
+		c.Data["CSP_NONCE"] = req.cspNonce
+	}
 
-	if it.service != nil {
-		for _, filter := range it.service.Filters {
-			filter(c)
-		}
+	if handlerController == nil && it.handlerModuler != nil {
+		handlerController = it.handlerModuler.find(r)
+	}
+
+	if it.service != nil && c.runFilters(it.service.Filters) {
+		return
+	}
+
+	if cfg != nil && c.runFilters(cfg.Filters) {
+		return
+	}
+
+	// No controller action of the module matches the path.
+	if handlerController == nil && it.handlerModuler != nil {
+		http.NotFound(resp, r)
+		return
 	}
 
 	if it.handlerAction != nil {
@@ -236,11 +472,6 @@ func (it *regHandler) handle(
 		return
 	}
 
-	var handlerController = it.handlerController
-	if handlerController == nil {
-		handlerController = it.handlerModuler.find(r)
-	}
-
 	if handlerController != nil {
 
 		var (
@@ -292,6 +523,114 @@ func (it *regHandler) handle(
 	}
 }
 
+// bodyLimits returns the body size limits of the route, 0 means no limit.
+func (it *regHandler) bodyLimits(cfg *RouteConfig) (maxBody, maxMemory, maxFile int64) {
+	if it.service != nil {
+		maxBody = it.service.Config.MaxBodySize
+		maxMemory = it.service.Config.MaxMultipartMemory
+		maxFile = it.service.Config.MaxFileSize
+	}
+	if cfg != nil {
+		if cfg.MaxBodySize != 0 {
+			maxBody = cfg.MaxBodySize
+		}
+		if cfg.MaxMultipartMemory != 0 {
+			maxMemory = cfg.MaxMultipartMemory
+		}
+		if cfg.MaxFileSize != 0 {
+			maxFile = cfg.MaxFileSize
+		}
+	}
+	return max(maxBody, 0), max(maxMemory, 0), max(maxFile, 0)
+}
+
+// decompressLimit returns the maximum size of a decompressed body, the body
+// limit or defaultMaxDecompressedSize by default, 0 means no limit.
+func (it *regHandler) decompressLimit(cfg *RouteConfig, maxBody int64) int64 {
+	var limit int64
+	if it.service != nil {
+		limit = it.service.Config.MaxDecompressedSize
+	}
+	if cfg != nil && cfg.MaxDecompressedSize != 0 {
+		limit = cfg.MaxDecompressedSize
+	}
+	if limit == 0 {
+		limit = maxBody
+	}
+	if limit == 0 {
+		// An unlimited decompression would let a small zip bomb fill the memory.
+		limit = defaultMaxDecompressedSize
+	}
+	return max(limit, 0)
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.timedOut && tw.status == 0 {
+		tw.status = status
+	}
+}
+
+// Flush sends the headers and the output buffered so far, so the streamed
+// responses go to the client before the handler returns.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.commit()
+	tw.w.Write(tw.buf.Bytes())
+	tw.buf.Reset()
+	http.NewResponseController(tw.w).Flush()
+}
+
+// commit sends the headers once, with tw.mu held.
+func (tw *timeoutWriter) commit() {
+	if tw.committed {
+		return
+	}
+	tw.committed = true
+	for k, v := range tw.header {
+		tw.w.Header()[k] = v
+	}
+	if tw.status > 0 {
+		tw.w.WriteHeader(tw.status)
+	}
+}
+
+// compressEncoding returns the response encoding selected for the
+// Accept-Encoding header value, or an empty string.
+func compressEncoding(ae string) string {
+	if strings.Contains(ae, "gzip") {
+		return "gzip"
+	} else if strings.Contains(ae, "br") {
+		return "br"
+	}
+	return ""
+}
+
+func (it *regHandler) routeConfig(r *http.Request) *RouteConfig {
+	if it.handlerModuler != nil {
+		return it.handlerModuler.config(r)
+	}
+	return it.config
+}
+
 func (it *handlerModuler) find(r *http.Request) *handlerController {
 	var (
 		ctrl   = r.PathValue("controller")
@@ -308,3 +647,13 @@ func (it *handlerModuler) find(r *http.Request) *handlerController {
 	}
 	return nil
 }
+
+func (it *handlerModuler) config(r *http.Request) *RouteConfig {
+	k := controllerActionPattern(r.PathValue("controller"), r.PathValue("action"))
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if cfg, ok := it.configs[k]; ok {
+		return cfg
+	}
+	return it.modConfig
+}
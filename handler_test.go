@@ -16,9 +16,13 @@ package httpsrv
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -454,3 +458,328 @@ func TestHandlerInfoAction(t *testing.T) {
 		t.Errorf("expected %q, got %q", expected, got)
 	}
 }
+
+func TestBodyLimit(t *testing.T) {
+	mod := NewModule()
+	mod.RegisterAction("/echo", func(ctx Ctx) error {
+		return ctx.Send(ctx.Body())
+	})
+	mod.RegisterAction("/upload", func(ctx Ctx) error {
+		return ctx.Send(ctx.Body())
+	})
+	mod.SetRouteConfig("/upload", RouteConfig{MaxBodySize: 64})
+
+	srv := NewService()
+	srv.Config.MaxBodySize = 16
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"within limit", "/echo/", "0123456789", false, http.StatusOK},
+		{"content length over limit", "/echo/", strings.Repeat("x", 32), false, http.StatusRequestEntityTooLarge},
+		{"chunked over limit", "/echo/", strings.Repeat("x", 32), true, http.StatusRequestEntityTooLarge},
+		{"route override", "/upload/", strings.Repeat("x", 32), false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBodyLimitDefault(t *testing.T) {
+	mod := NewModule()
+	mod.RegisterAction("/form", func(ctx Ctx) error {
+		return ctx.Send([]byte(ctx.Params().Value("name")))
+	})
+
+	srv := NewService()
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	for _, chunked := range []bool{false, true} {
+		body := io.MultiReader(strings.NewReader("name="), io.LimitReader(zeroReader{}, 33<<20))
+		req := httptest.NewRequest("POST", "/form/", body)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.ContentLength = 5 + 33<<20
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked %v: expected 413 over the default body limit, got %d", chunked, rec.Code)
+		}
+	}
+}
+
+// zeroReader reads "0" bytes endlessly.
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = '0'
+	}
+	return len(b), nil
+}
+
+func TestStreamBody(t *testing.T) {
+	mod := NewModule()
+	mod.RegisterAction("/ingest", func(ctx Ctx) error {
+		var calls, total int64
+		body, err := io.ReadAll(ctx.Request().BodyReader(func(read, size int64) {
+			calls, total = calls+1, read
+		}))
+		if err != nil {
+			return nil
+		}
+		return ctx.Send([]byte(fmt.Sprintf("%s|%d|%q|%q|%v",
+			body, total, ctx.Request().RawBody(), ctx.Params().Value("name"), calls > 0)))
+	})
+	mod.RegisterAction("/decode", func(ctx Ctx) error {
+		var v struct {
+			Name string `json:"name"`
+		}
+		if err := ctx.Request().Decode(&v); err != nil {
+			return err
+		}
+		return ctx.Send([]byte(v.Name))
+	})
+	mod.Config = RouteConfig{StreamBody: true, MaxBodySize: 32}
+
+	srv := NewService()
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{"form not buffered", "/ingest/", "application/x-www-form-urlencoded", "name=alice", http.StatusOK, `name=alice|10|""|""|true`},
+		{"over limit", "/ingest/", "application/octet-stream", strings.Repeat("x", 64), http.StatusRequestEntityTooLarge, ""},
+		{"decode", "/decode/", "application/json", `{"name":"bob"}`, http.StatusOK, "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.ContentLength = -1
+			rec := httptest.NewRecorder()
+
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.want {
+				t.Errorf("expected body %q, got %q", tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBodyLimitMultipartFile(t *testing.T) {
+	srv := NewService()
+	srv.Config.MaxFileSize = 8
+
+	srv.regHandler(&regHandler{
+		pattern: "/upload",
+		handlerAction: &handlerAction{
+			name: "Upload",
+			fn: func(ctx Ctx) error {
+				return ctx.Send([]byte(ctx.Params().Value("title")))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	for _, size := range []int{4, 16} {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("title", "doc")
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		fw.Write(bytes.Repeat([]byte("x"), size))
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/upload/", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if size <= 8 && (rec.Code != http.StatusOK || rec.Body.String() != "doc") {
+			t.Errorf("file size %d: expected 200 doc, got %d %q", size, rec.Code, rec.Body.String())
+		} else if size > 8 && rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("file size %d: expected 413, got %d", size, rec.Code)
+		}
+	}
+}
+
+// countReader counts the bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
+}
+
+func TestBodyLimitMultipartFileEarly(t *testing.T) {
+	srv := NewService()
+	srv.Config.MaxFileSize = 1 << 10
+
+	srv.regHandler(&regHandler{
+		pattern: "/upload",
+		handlerAction: &handlerAction{
+			name: "Upload",
+			fn: func(ctx Ctx) error {
+				if _, err := ctx.Params().File("file"); err != nil {
+					return err
+				}
+				return ctx.Send([]byte(ctx.Params().Value("title")))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	for _, size := range []int{512, 8 << 20} {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("title", "doc")
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		fw.Write(bytes.Repeat([]byte("x"), size))
+		mw.Close()
+
+		var (
+			total = int64(buf.Len())
+			body  = &countReader{r: &buf}
+			req   = httptest.NewRequest("POST", "/upload/", body)
+			rec   = httptest.NewRecorder()
+		)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if size < 1<<10 {
+			if rec.Code != http.StatusOK || rec.Body.String() != "doc" {
+				t.Errorf("file size %d: expected 200 doc, got %d %q", size, rec.Code, rec.Body.String())
+			}
+			continue
+		}
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("file size %d: expected 413, got %d", size, rec.Code)
+		}
+		if body.n >= total/2 {
+			t.Errorf("file size %d: expected the body to be rejected early, read %d of %d bytes", size, body.n, total)
+		}
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	mod := NewModule()
+	mod.Config.Timeout = 1
+	mod.Config.TimeoutStatus = http.StatusGatewayTimeout
+	mod.Config.TimeoutBody = "export timed out"
+
+	mod.RegisterAction("/fast", func(ctx Ctx) error {
+		ctx.Response().Header().Set("X-Test", "fast")
+		return ctx.Send([]byte("done"))
+	})
+	mod.RegisterAction("/slow", func(ctx Ctx) error {
+		select {
+		case <-ctx.Request().Context().Done():
+			return ctx.Request().Context().Err()
+		case <-time.After(3 * time.Second):
+		}
+		return ctx.Send([]byte("too late"))
+	})
+	mod.RegisterAction("/export", func(ctx Ctx) error {
+		time.Sleep(100 * time.Millisecond)
+		return ctx.Send([]byte("exported"))
+	})
+	mod.SetRouteConfig("/export", RouteConfig{Timeout: 2})
+
+	srv := NewService()
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/fast/", http.StatusOK, "done"},
+		{"/slow/", http.StatusGatewayTimeout, "export timed out"},
+		{"/export/", http.StatusOK, "exported"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		rec := httptest.NewRecorder()
+
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, rec.Code, rec.Body.String())
+		}
+	}
+
+	// a client disconnect is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/slow/", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	cancel()
+
+	h, urlPath, _ := srv.router.find(req)
+	h.handle(rec, req, urlPath, urlPath, time.Now())
+
+	if rec.Flushed || rec.Body.Len() > 0 || rec.Header().Get("Content-Type") != "" {
+		t.Errorf("expected no response to a gone client, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -67,6 +67,16 @@ func (c *Cache) Get(key interface{}) (value interface{}, ok bool) {
 	return
 }
 
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ele, hit := c.cache[key]; hit {
+		c.ll.Remove(ele)
+		delete(c.cache, key)
+	}
+}
+
 // RemoveOldest removes the oldest item in the cache and returns its key and value.
 // If the cache is empty, the empty string and nil are returned.
 func (c *Cache) RemoveOldest() (key, value interface{}) {
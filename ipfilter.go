@@ -0,0 +1,178 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPFilter allows or denies requests by the client IP (see Request.ClientIP),
+// with lists of IP addresses and CIDR blocks. The entry "unix" matches the
+// peers of a unix socket. Denied addresses win, and when the allow list is not
+// empty only its addresses are allowed. Use the Filter method in the Filters of
+// a module or of a route, e.g.
+//
+//	admin := httpsrv.NewIPFilter([]string{"10.1.0.0/16", "127.0.0.1", "::1", "unix"}, nil)
+//	mod.Config.Filters = append(mod.Config.Filters, admin.Filter)
+//	mod.SetRouteConfig("/metrics", httpsrv.RouteConfig{
+//		Filters: []httpsrv.Filter{admin.Filter},
+//	})
+//
+// The Filters of the service run only for the controller actions, not for the
+// file servers nor the handler funcs, which run the filters of their route.
+type IPFilter struct {
+	// When set with files, the files are checked for changes at most once
+	// per interval, and reloaded.
+	ReloadInterval time.Duration
+
+	mu        sync.RWMutex
+	allow     *ipNetList
+	deny      *ipNetList
+	allowFile string
+	denyFile  string
+	modTimes  [2]time.Time
+	checked   time.Time
+}
+
+func NewIPFilter(allow, deny []string) *IPFilter {
+	return &IPFilter{
+		allow: parseIPNetList(allow),
+		deny:  parseIPNetList(deny),
+	}
+}
+
+// NewIPFilterFromFiles loads the lists from files holding one entry per line,
+// "#" starts a comment line. Any of the files may be empty.
+func NewIPFilterFromFiles(allowFile, denyFile string) (*IPFilter, error) {
+	f := &IPFilter{
+		allowFile: allowFile,
+		denyFile:  denyFile,
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetLists replaces the lists.
+func (f *IPFilter) SetLists(allow, deny []string) {
+	a, d := parseIPNetList(allow), parseIPNetList(deny)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.allow, f.deny = a, d
+}
+
+// Reload reads the lists again from the files.
+func (f *IPFilter) Reload() error {
+
+	var (
+		lists    [2]*ipNetList
+		modTimes [2]time.Time
+	)
+
+	for i, file := range []string{f.allowFile, f.denyFile} {
+		if file == "" {
+			lists[i] = &ipNetList{}
+			continue
+		}
+		st, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		lists[i] = parseIPNetList(strings.Split(string(b), "\n"))
+		modTimes[i] = st.ModTime()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.allow, f.deny = lists[0], lists[1]
+	f.modTimes = modTimes
+	f.checked = time.Now()
+
+	return nil
+}
+
+func (f *IPFilter) reloadIfChanged() {
+
+	f.mu.RLock()
+	due := (f.allowFile != "" || f.denyFile != "") &&
+		f.ReloadInterval > 0 && time.Since(f.checked) >= f.ReloadInterval
+	f.mu.RUnlock()
+
+	if !due {
+		return
+	}
+
+	f.mu.Lock()
+	changed := false
+	for i, file := range []string{f.allowFile, f.denyFile} {
+		if file == "" {
+			continue
+		}
+		if st, err := os.Stat(file); err == nil && !st.ModTime().Equal(f.modTimes[i]) {
+			changed = true
+		}
+	}
+	f.checked = time.Now()
+	f.mu.Unlock()
+
+	if changed {
+		if err := f.Reload(); err != nil {
+			slog.Warn("httpsrv ip filter reload fail", "err", err)
+		}
+	}
+}
+
+// Allowed reports whether the client of the request may be served.
+func (f *IPFilter) Allowed(req *Request) bool {
+
+	f.reloadIfChanged()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.deny.matchClient(req) {
+		return false
+	}
+	return f.allow.empty() || f.allow.matchClient(req)
+}
+
+// Filter answers 403 to the clients which are not allowed.
+func (f *IPFilter) Filter(c *Controller) {
+	if !f.Allowed(c.Request) {
+		c.RenderError(http.StatusForbidden, "403 Forbidden")
+	}
+}
+
+// matchClient reports whether the client IP of the request belongs to the list.
+func (it *ipNetList) matchClient(req *Request) bool {
+	if it == nil {
+		return false
+	}
+	if ip := net.ParseIP(req.ClientIP()); ip != nil {
+		return it.contains(ip)
+	}
+	return it.unix && isUnixRemoteAddr(req.RemoteAddr)
+}
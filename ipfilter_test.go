@@ -0,0 +1,128 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestIPFilter(t *testing.T) {
+
+	f := NewIPFilter([]string{"10.1.0.0/16", "127.0.0.1", "::1", "unix"}, []string{"10.1.9.9"})
+
+	tests := []struct {
+		remoteAddr string
+		allowed    bool
+	}{
+		{"10.1.2.3:1000", true},
+		{"10.1.9.9:1000", false},
+		{"10.2.0.1:1000", false},
+		{"127.0.0.1:1000", true},
+		{"[::1]:1000", true},
+		{"@", true},
+		{"192.0.2.1:1000", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/admin", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if got := f.Allowed(newRequest(r)); got != tt.allowed {
+				t.Errorf("expected allowed %v, got %v", tt.allowed, got)
+			}
+		})
+	}
+
+	// deny only
+	f.SetLists(nil, []string{"192.0.2.0/24"})
+	r := httptest.NewRequest("GET", "/admin", nil)
+	r.RemoteAddr = "198.51.100.1:1000"
+	if !f.Allowed(newRequest(r)) {
+		t.Error("expected an address out of the deny list to be allowed")
+	}
+}
+
+func TestIPFilterReloadFile(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(file, []byte("# office\n10.1.0.0/16\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewIPFilterFromFiles(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ReloadInterval = time.Nanosecond
+
+	r := httptest.NewRequest("GET", "/admin", nil)
+	r.RemoteAddr = "192.0.2.1:1000"
+	if f.Allowed(newRequest(r)) {
+		t.Fatal("expected the address to be denied")
+	}
+
+	if err := os.WriteFile(file, []byte("10.1.0.0/16\n192.0.2.0/24\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+
+	if !f.Allowed(newRequest(r)) {
+		t.Error("expected the address to be allowed after the file reload")
+	}
+}
+
+func TestIPFilterFileServer(t *testing.T) {
+
+	mod := NewModule()
+	mod.Config.Filters = []Filter{NewIPFilter([]string{"10.1.0.0/16"}, nil).Filter}
+	mod.RegisterFileServer("/static", "", http.FS(fstest.MapFS{
+		"app.js": {Data: []byte("console.log(1)")},
+	}))
+
+	srv := NewService()
+	srv.HandleModule("/admin", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"10.1.2.3:1000", http.StatusOK},
+		{"192.0.2.1:1000", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/static/app.js", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d %q", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
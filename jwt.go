@@ -0,0 +1,574 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTKey is a key used to sign or verify JSON Web Tokens.
+//
+// The Key type depends on the algorithm:
+//
+//	HS256  []byte
+//	RS256  *rsa.PublicKey or *rsa.PrivateKey
+//	ES256  *ecdsa.PublicKey or *ecdsa.PrivateKey (P-256)
+//	EdDSA  ed25519.PublicKey or ed25519.PrivateKey
+//
+// Private keys are required to sign tokens.
+type JWTKey struct {
+	ID  string
+	Alg string
+	Key interface{}
+}
+
+// JWTKeySet is a set of keys selected by the "kid" header of the tokens,
+// which allows the rotation of keys.
+type JWTKeySet struct {
+	mu   sync.RWMutex
+	keys []*JWTKey
+}
+
+// JWTClaims is the payload of a JSON Web Token.
+type JWTClaims map[string]interface{}
+
+// JWTAuthenticator verifies the JSON Web Tokens sent in the
+// "Authorization: Bearer <token>" header or in the session cookie.
+type JWTAuthenticator struct {
+	Keys *JWTKeySet
+
+	// If set, the "iss" claim must be equal to Issuer, and the "aud" claim
+	// must contain Audience.
+	Issuer   string
+	Audience string
+
+	// Tolerance of the "exp" and "nbf" checks. A token with a non-numeric
+	// "exp" or "nbf" claim is rejected with ErrJWTClaims.
+	ClockSkew time.Duration
+
+	// Name of the cookie holding the token, defaults to the
+	// Config.CookieKeyToken of the service.
+	CookieKey string
+}
+
+var (
+	ErrJWTMalformed = errors.New("jwt: malformed token")
+	ErrJWTSignature = errors.New("jwt: invalid signature")
+	ErrJWTExpired   = errors.New("jwt: token expired or not yet valid")
+	ErrJWTClaims    = errors.New("jwt: invalid claims")
+)
+
+var jwtEncoding = base64.RawURLEncoding
+
+func NewJWTKeySet(keys ...*JWTKey) *JWTKeySet {
+	ks := &JWTKeySet{}
+	for _, k := range keys {
+		ks.Add(k)
+	}
+	return ks
+}
+
+// Add adds a key, or replaces the key of the same ID.
+func (ks *JWTKeySet) Add(key *JWTKey) {
+	if key == nil {
+		return
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for i, k := range ks.keys {
+		if k.ID == key.ID {
+			ks.keys[i] = key
+			return
+		}
+	}
+	ks.keys = append(ks.keys, key)
+}
+
+// Remove removes the key of the given ID.
+func (ks *JWTKeySet) Remove(id string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for i, k := range ks.keys {
+		if k.ID == id {
+			ks.keys = append(ks.keys[:i], ks.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// LoadFile replaces the keys with the ones of a JWKS (RFC 7517) file.
+func (ks *JWTKeySet) LoadFile(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return ks.load(b)
+}
+
+// LoadFileSystem replaces the keys with the ones of a JWKS (RFC 7517) file
+// of a http.FileSystem.
+func (ks *JWTKeySet) LoadFileSystem(fs http.FileSystem, path string) error {
+	fp, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	b, err := io.ReadAll(io.LimitReader(fp, 1<<20))
+	if err != nil {
+		return err
+	}
+	return ks.load(b)
+}
+
+type jwkSet struct {
+	Keys []jwkItem `json:"keys"`
+}
+
+type jwkItem struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (ks *JWTKeySet) load(b []byte) error {
+
+	var set jwkSet
+	if err := jsonDecode(b, &set); err != nil {
+		return err
+	}
+
+	keys := []*JWTKey{}
+	for _, v := range set.Keys {
+		if v.Use != "" && v.Use != "sig" {
+			continue
+		}
+		key, err := v.key()
+		if err != nil {
+			return fmt.Errorf("jwks key %q: %w", v.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (v *jwkItem) key() (*JWTKey, error) {
+
+	key := &JWTKey{
+		ID:  v.Kid,
+		Alg: v.Alg,
+	}
+
+	switch v.Kty {
+	case "oct":
+		k, err := jwtEncoding.DecodeString(v.K)
+		if err != nil {
+			return nil, err
+		}
+		key.Key = k
+		if key.Alg == "" {
+			key.Alg = "HS256"
+		}
+
+	case "RSA":
+		n, err1 := jwtEncoding.DecodeString(v.N)
+		e, err2 := jwtEncoding.DecodeString(v.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil, ErrJWTMalformed
+		}
+		key.Key = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if key.Alg == "" {
+			key.Alg = "RS256"
+		}
+
+	case "EC":
+		if v.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", v.Crv)
+		}
+		x, err1 := jwtEncoding.DecodeString(v.X)
+		y, err2 := jwtEncoding.DecodeString(v.Y)
+		if err1 != nil || err2 != nil {
+			return nil, ErrJWTMalformed
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrJWTMalformed
+		}
+		key.Key = pub
+		if key.Alg == "" {
+			key.Alg = "ES256"
+		}
+
+	case "OKP":
+		if v.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", v.Crv)
+		}
+		x, err := jwtEncoding.DecodeString(v.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrJWTMalformed
+		}
+		key.Key = ed25519.PublicKey(x)
+		if key.Alg == "" {
+			key.Alg = "EdDSA"
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", v.Kty)
+	}
+
+	return key, nil
+}
+
+func (ks *JWTKeySet) find(kid, alg string) []*JWTKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var keys []*JWTKey
+	for _, k := range ks.keys {
+		if k.Alg == alg && (kid == "" || k.ID == kid) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// NewJWTClaims returns the claims of a token issued now for the subject,
+// expiring after ttl.
+func NewJWTClaims(subject string, ttl time.Duration) JWTClaims {
+	now := time.Now()
+	return JWTClaims{
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+}
+
+func (c JWTClaims) StringValue(name string) string {
+	if v, ok := c[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (c JWTClaims) Subject() string {
+	return c.StringValue("sub")
+}
+
+func (c JWTClaims) Issuer() string {
+	return c.StringValue("iss")
+}
+
+// TimeValue returns the value of a NumericDate claim such as "exp", "nbf" or "iat".
+func (c JWTClaims) TimeValue(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// StringSlice returns the value of a claim which is either a string or an array
+// of strings, such as "aud" or "roles".
+func (c JWTClaims) StringSlice(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		ls := make([]string, 0, len(v))
+		for _, v2 := range v {
+			if s, ok := v2.(string); ok {
+				ls = append(ls, s)
+			}
+		}
+		return ls
+	}
+	return nil
+}
+
+// Sign returns the compact serialization of a token of the claims.
+func (k *JWTKey) Sign(claims JWTClaims) (string, error) {
+
+	hdr := map[string]string{
+		"alg": k.Alg,
+		"typ": "JWT",
+	}
+	if k.ID != "" {
+		hdr["kid"] = k.ID
+	}
+
+	hb, err := jsonEncode(hdr, "")
+	if err != nil {
+		return "", err
+	}
+	pb, err := jsonEncode(claims, "")
+	if err != nil {
+		return "", err
+	}
+
+	signed := jwtEncoding.EncodeToString(hb) + "." + jwtEncoding.EncodeToString(pb)
+
+	sig, err := k.sign([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + jwtEncoding.EncodeToString(sig), nil
+}
+
+func (k *JWTKey) sign(data []byte) ([]byte, error) {
+
+	switch key := k.Key.(type) {
+	case []byte:
+		if k.Alg == "HS256" {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(data)
+			return mac.Sum(nil), nil
+		}
+
+	case *rsa.PrivateKey:
+		if k.Alg == "RS256" {
+			sum := sha256.Sum256(data)
+			return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		}
+
+	case *ecdsa.PrivateKey:
+		if k.Alg == "ES256" {
+			sum := sha256.Sum256(data)
+			r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+			if err != nil {
+				return nil, err
+			}
+			sig := make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+			return sig, nil
+		}
+
+	case ed25519.PrivateKey:
+		if k.Alg == "EdDSA" {
+			return ed25519.Sign(key, data), nil
+		}
+	}
+
+	return nil, fmt.Errorf("jwt: key %q can not sign %s", k.ID, k.Alg)
+}
+
+func (k *JWTKey) verify(data, sig []byte) bool {
+
+	switch key := k.Key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hmac.Equal(sig, mac.Sum(nil))
+
+	case *rsa.PrivateKey:
+		return (&JWTKey{Alg: k.Alg, Key: &key.PublicKey}).verify(data, sig)
+
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil
+
+	case *ecdsa.PrivateKey:
+		return (&JWTKey{Alg: k.Alg, Key: &key.PublicKey}).verify(data, sig)
+
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		sum := sha256.Sum256(data)
+		return ecdsa.Verify(key, sum[:],
+			new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+
+	case ed25519.PrivateKey:
+		return ed25519.Verify(key.Public().(ed25519.PublicKey), data, sig)
+
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	}
+
+	return false
+}
+
+func NewJWTAuthenticator(keys *JWTKeySet) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		Keys:      keys,
+		ClockSkew: time.Minute,
+	}
+}
+
+// Verify checks the signature and the registered claims of a token.
+func (it *JWTAuthenticator) Verify(token string) (JWTClaims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || it.Keys == nil {
+		return nil, ErrJWTMalformed
+	}
+
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	hb, err := jwtEncoding.DecodeString(parts[0])
+	if err != nil || jsonDecode(hb, &hdr) != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	sig, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	// The algorithm is bound to the key, "none" or a mismatching alg never
+	// find a key.
+	var (
+		signed = []byte(parts[0] + "." + parts[1])
+		valid  = false
+	)
+	for _, key := range it.Keys.find(hdr.Kid, hdr.Alg) {
+		if key.verify(signed, sig) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrJWTSignature
+	}
+
+	var claims JWTClaims
+	pb, err := jwtEncoding.DecodeString(parts[1])
+	if err != nil || jsonDecode(pb, &claims) != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	now := time.Now()
+	for _, name := range []string{"exp", "nbf"} {
+		// a time claim which is not a NumericDate is not ignored
+		if _, ok := claims[name]; ok {
+			if _, ok = claims.TimeValue(name); !ok {
+				return nil, ErrJWTClaims
+			}
+		}
+	}
+	if exp, ok := claims.TimeValue("exp"); ok && now.After(exp.Add(it.ClockSkew)) {
+		return nil, ErrJWTExpired
+	}
+	if nbf, ok := claims.TimeValue("nbf"); ok && now.Before(nbf.Add(-it.ClockSkew)) {
+		return nil, ErrJWTExpired
+	}
+	if it.Issuer != "" && claims.Issuer() != it.Issuer {
+		return nil, ErrJWTClaims
+	}
+	if it.Audience != "" {
+		found := false
+		for _, v := range claims.StringSlice("aud") {
+			if v == it.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrJWTClaims
+		}
+	}
+
+	return claims, nil
+}
+
+// Authenticate implements Authenticator. The principal name is the "sub"
+// claim, the roles are the "roles" claim, and Attrs holds all the claims.
+func (it *JWTAuthenticator) Authenticate(req *Request) (*Principal, error) {
+
+	token := bearerToken(req.Header.Get("Authorization"))
+	if token == "" {
+		key := it.CookieKey
+		if key == "" && req.service != nil {
+			key = req.service.Config.CookieKeyToken
+		}
+		if key == "" {
+			key = DefaultConfig.CookieKeyToken
+		}
+		if v, err := req.Cookie(key); err == nil {
+			token = v.Value
+		}
+	}
+	if token == "" {
+		return nil, nil
+	}
+
+	claims, err := it.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		Name:   claims.Subject(),
+		Roles:  claims.StringSlice("roles"),
+		Scheme: "jwt",
+		Attrs:  claims,
+	}, nil
+}
+
+func (it *JWTAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+// Claims returns the validated claims of the JWT the request was
+// authenticated with, or nil.
+func (c *Controller) Claims() JWTClaims {
+	if c.User != nil && c.User.Scheme == "jwt" {
+		return c.User.Attrs
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJWTSignVerify(t *testing.T) {
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	keys := []*JWTKey{
+		{ID: "hs", Alg: "HS256", Key: []byte("0123456789abcdef0123456789abcdef")},
+		{ID: "rs", Alg: "RS256", Key: rsaKey},
+		{ID: "es", Alg: "ES256", Key: ecKey},
+		{ID: "ed", Alg: "EdDSA", Key: edKey},
+	}
+
+	auth := NewJWTAuthenticator(NewJWTKeySet(keys...))
+	auth.Issuer = "httpsrv"
+	auth.Audience = "api"
+
+	for _, key := range keys {
+		t.Run(key.Alg, func(t *testing.T) {
+
+			claims := NewJWTClaims("alice", time.Hour)
+			claims["iss"] = "httpsrv"
+			claims["aud"] = []string{"web", "api"}
+
+			token, err := key.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := auth.Verify(token)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if got.Subject() != "alice" {
+				t.Errorf("expected subject alice, got %q", got.Subject())
+			}
+
+			// tampered payload
+			tampered := token[:len(token)-4] + "AAAA"
+			if _, err := auth.Verify(tampered); err == nil {
+				t.Error("expected an error for a tampered token")
+			}
+		})
+	}
+
+	tests := []struct {
+		name   string
+		claims JWTClaims
+		err    error
+	}{
+		{"expired", JWTClaims{"sub": "a", "iss": "httpsrv", "aud": "api", "exp": time.Now().Add(-time.Hour).Unix()}, ErrJWTExpired},
+		{"skew", JWTClaims{"sub": "a", "iss": "httpsrv", "aud": "api", "exp": time.Now().Add(-30 * time.Second).Unix()}, nil},
+		{"not before", JWTClaims{"sub": "a", "iss": "httpsrv", "aud": "api", "nbf": time.Now().Add(time.Hour).Unix()}, ErrJWTExpired},
+		{"malformed exp", JWTClaims{"sub": "a", "iss": "httpsrv", "aud": "api", "exp": "tomorrow"}, ErrJWTClaims},
+		{"malformed nbf", JWTClaims{"sub": "a", "iss": "httpsrv", "aud": "api", "nbf": nil}, ErrJWTClaims},
+		{"issuer", JWTClaims{"sub": "a", "iss": "other", "aud": "api"}, ErrJWTClaims},
+		{"audience", JWTClaims{"sub": "a", "iss": "httpsrv", "aud": "web"}, ErrJWTClaims},
+	}
+
+	for _, tt := range tests {
+		token, _ := keys[0].Sign(tt.claims)
+		if _, err := auth.Verify(token); err != tt.err {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+
+	// alg confusion: a HS256 token signed with the RSA public key bytes
+	// must not verify against the RSA key.
+	token, _ := (&JWTKey{ID: "rs", Alg: "HS256", Key: rsaKey.N.Bytes()}).Sign(NewJWTClaims("a", time.Hour))
+	if _, err := auth.Verify(token); err != ErrJWTSignature {
+		t.Errorf("expected ErrJWTSignature, got %v", err)
+	}
+}
+
+func TestJWTKeySetLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	jwks := `{"keys":[
+		{"kty":"oct","kid":"k1","k":"c2VjcmV0LWtleS0x"},
+		{"kty":"OKP","kid":"k2","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "jwks.json"), []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ks := NewJWTKeySet()
+	if err := ks.LoadFileSystem(http.Dir(dir), "/jwks.json"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ks.keys); n != 2 {
+		t.Fatalf("expected 2 signing keys, got %d", n)
+	}
+
+	// rotation: tokens are matched by kid
+	token, _ := (&JWTKey{ID: "k1", Alg: "HS256", Key: []byte("secret-key-1")}).Sign(NewJWTClaims("bob", time.Hour))
+
+	auth := NewJWTAuthenticator(ks)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultConfig.CookieKeyToken, Value: token})
+
+	p, err := auth.Authenticate(newRequest(r))
+	if err != nil || p == nil || p.Name != "bob" {
+		t.Fatalf("unexpected principal %+v, %v", p, err)
+	}
+
+	c := &Controller{User: p}
+	if c.Claims().Subject() != "bob" {
+		t.Errorf("expected claims of bob, got %v", c.Claims())
+	}
+
+	// the cookie named by the service config
+	srv := NewService()
+	srv.Config.CookieKeyToken = "tk"
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "tk", Value: token})
+	req := newRequest(r)
+	req.service = srv
+	if p, err := auth.Authenticate(req); err != nil || p == nil || p.Name != "bob" {
+		t.Errorf("unexpected principal %+v, %v from the configured cookie", p, err)
+	}
+
+	ks.Remove("k1")
+	if _, err := auth.Authenticate(req); err != ErrJWTSignature {
+		t.Errorf("expected ErrJWTSignature after key removal, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Priority is the admission class of a request under a ConcurrencyLimiter.
+type Priority int
+
+const (
+	// PriorityNormal requests wait in the queue when all slots are busy.
+	PriorityNormal Priority = iota
+
+	// PriorityLow requests are rejected as soon as all slots are busy.
+	PriorityLow
+
+	// PriorityCritical requests, such as health checks, are always admitted
+	// and do not take a slot.
+	PriorityCritical
+)
+
+// ConcurrencyLimiter caps the number of requests in flight. When all slots
+// are busy, requests wait in a bounded queue for up to QueueTimeout, and the
+// others get a 503 right away. Set it on Service.Limiter for all the routes,
+// or on RouteConfig.Limiter for some of them, e.g.
+//
+//	srv.Limiter = &httpsrv.ConcurrencyLimiter{
+//		MaxInFlight:  200,
+//		MaxQueue:     100,
+//		QueueTimeout: 2 * time.Second,
+//	}
+//	mod.SetRouteConfig("/health", httpsrv.RouteConfig{
+//		Priority: httpsrv.PriorityCritical,
+//	})
+type ConcurrencyLimiter struct {
+	MaxInFlight int
+	MaxQueue    int
+
+	// The maximum wait in the queue, zero waits until the client goes away.
+	QueueTimeout time.Duration
+
+	// Value of the Retry-After header of the rejected requests, omitted when zero.
+	RetryAfter time.Duration
+
+	// Classify sets the priority of the requests of the routes without
+	// RouteConfig.Priority.
+	Classify func(r *http.Request) Priority
+
+	once   sync.Once
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+func (l *ConcurrencyLimiter) init() {
+	l.once.Do(func() {
+		n := l.MaxInFlight
+		if n < 1 {
+			n = 1
+		}
+		l.slots = make(chan struct{}, n)
+	})
+}
+
+// InFlight returns the number of the admitted requests.
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.init()
+	return len(l.slots)
+}
+
+// Queued returns the number of the requests waiting for a slot.
+func (l *ConcurrencyLimiter) Queued() int {
+	return int(l.queued.Load())
+}
+
+// acquire waits for a slot, and reports whether the request is admitted.
+func (l *ConcurrencyLimiter) acquire(r *http.Request, p Priority) (func(), bool) {
+
+	if p == PriorityCritical {
+		return func() {}, true
+	}
+
+	l.init()
+
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	if p == PriorityLow || l.MaxQueue < 1 {
+		return nil, false
+	}
+
+	if l.queued.Add(1) > int64(l.MaxQueue) {
+		l.queued.Add(-1)
+		return nil, false
+	}
+	defer l.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if l.QueueTimeout > 0 {
+		t := time.NewTimer(l.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, true
+	case <-timeout:
+	case <-r.Context().Done():
+	}
+
+	return nil, false
+}
+
+func (l *ConcurrencyLimiter) reject(w http.ResponseWriter) {
+	if l.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(l.RetryAfter/time.Second), 10))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte("503 Service Unavailable"))
+}
+
+// admit runs the request through the limiters of the service and of the
+// route. It answers the rejected requests, and returns the release function
+// of the admitted ones.
+func (it *regHandler) admit(w http.ResponseWriter, r *http.Request, cfg *RouteConfig) (func(), bool) {
+
+	var limiters []*ConcurrencyLimiter
+	if it.service != nil && it.service.Limiter != nil {
+		limiters = append(limiters, it.service.Limiter)
+	}
+	if cfg != nil && cfg.Limiter != nil && (len(limiters) == 0 || cfg.Limiter != limiters[0]) {
+		limiters = append(limiters, cfg.Limiter)
+	}
+
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	for _, l := range limiters {
+		p := PriorityNormal
+		if cfg != nil && cfg.Priority != PriorityNormal {
+			p = cfg.Priority
+		} else if l.Classify != nil {
+			p = l.Classify(r)
+		}
+		fn, ok := l.acquire(r, p)
+		if !ok {
+			release()
+			l.reject(w)
+			return nil, false
+		}
+		releases = append(releases, fn)
+	}
+
+	return release, true
+}
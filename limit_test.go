@@ -0,0 +1,143 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+
+	l := &ConcurrencyLimiter{
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: 20 * time.Millisecond,
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	release, ok := l.acquire(r, PriorityNormal)
+	if !ok {
+		t.Fatal("expected the first request to be admitted")
+	}
+
+	tests := []struct {
+		name     string
+		priority Priority
+		ok       bool
+	}{
+		{"queue timeout", PriorityNormal, false},
+		{"low shed", PriorityLow, false},
+		{"critical", PriorityCritical, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := l.acquire(r, tt.priority); ok != tt.ok {
+				t.Errorf("expected admitted %v, got %v", tt.ok, ok)
+			}
+		})
+	}
+
+	// A queued request gets the slot released by the first one.
+	done := make(chan bool)
+	go func() {
+		fn, ok := l.acquire(r, PriorityNormal)
+		if ok {
+			fn()
+		}
+		done <- ok
+	}()
+	for l.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	if !<-done {
+		t.Error("expected the queued request to be admitted")
+	}
+	if n := l.InFlight(); n != 0 {
+		t.Errorf("expected no request in flight, got %d", n)
+	}
+}
+
+func TestConcurrencyLimiterRoute(t *testing.T) {
+
+	var (
+		srv     = NewService()
+		started = make(chan struct{})
+		unblock = make(chan struct{})
+	)
+	srv.Limiter = &ConcurrencyLimiter{
+		MaxInFlight: 1,
+		RetryAfter:  time.Second,
+	}
+
+	srv.regHandler(&regHandler{
+		pattern: "/slow",
+		handlerAction: &handlerAction{
+			name: "Slow",
+			fn: func(ctx Ctx) error {
+				close(started)
+				<-unblock
+				return nil
+			},
+		},
+	})
+	srv.regHandler(&regHandler{
+		pattern: "/health",
+		handlerAction: &handlerAction{
+			name: "Health",
+			fn: func(ctx Ctx) error {
+				return ctx.Send([]byte("ok"))
+			},
+		},
+		config: &RouteConfig{Priority: PriorityCritical},
+	})
+	for _, h := range srv.handlers[len(srv.handlers)-2:] {
+		srv.router.add(h.pattern, h)
+	}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		return rec
+	}
+
+	done := make(chan struct{})
+	go func() {
+		serve("/slow/")
+		close(done)
+	}()
+	<-started
+
+	rec := serve("/slow/")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 over the limit, got %d", rec.Code)
+	}
+	if v := rec.Header().Get("Retry-After"); v != "1" {
+		t.Errorf("expected Retry-After 1, got %q", v)
+	}
+
+	if rec := serve("/health/"); rec.Code != http.StatusOK {
+		t.Errorf("expected the critical route to be admitted, got %d", rec.Code)
+	}
+
+	close(unblock)
+	<-done
+}
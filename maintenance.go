@@ -0,0 +1,182 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>503 Service Unavailable</title></head>
+<body>
+<h1>Service Unavailable</h1>
+<p>{{if .Message}}{{.Message}}{{else}}The service is down for maintenance, please try again later.{{end}}</p>
+</body>
+</html>`
+
+// Maintenance answers every request of a service with a 503 page while it is
+// enabled, by Enable or by the presence of File, e.g.
+//
+//	srv.Maintenance = &httpsrv.Maintenance{
+//		File:         "/var/run/app/maintenance",
+//		RetryAfter:   10 * time.Minute,
+//		BypassIPs:    []string{"10.1.0.0/16", "unix"},
+//		BypassCookie: "ops_bypass",
+//		BypassToken:  "secret",
+//	}
+//
+// Operators reach the service as usual from BypassIPs, or with the
+// BypassToken in the BypassHeader or BypassCookie.
+type Maintenance struct {
+	// The maintenance mode is on while this file exists.
+	File string
+
+	// Value of the Retry-After header, omitted when zero.
+	RetryAfter time.Duration
+
+	// Template is the html/template text of the page, executed with the
+	// .Message, .RetryAfter (seconds) and .CSP_NONCE fields.
+	Template string
+	Message  string
+
+	BypassIPs    []string
+	BypassHeader string
+	BypassCookie string
+	BypassToken  string
+
+	enabled atomic.Bool
+
+	mu          sync.Mutex
+	bypassNets  *ipNetList
+	fileOn      bool
+	fileChecked time.Time
+}
+
+// maintenanceFileCheckInterval is how often the presence of Maintenance.File
+// is checked.
+const maintenanceFileCheckInterval = time.Second
+
+func (m *Maintenance) Enable() {
+	m.enabled.Store(true)
+}
+
+func (m *Maintenance) Disable() {
+	m.enabled.Store(false)
+}
+
+// Enabled reports whether the maintenance mode is on.
+func (m *Maintenance) Enabled() bool {
+
+	if m.enabled.Load() {
+		return true
+	}
+	if m.File == "" {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.fileChecked) >= maintenanceFileCheckInterval {
+		_, err := os.Stat(m.File)
+		m.fileOn = err == nil
+		m.fileChecked = time.Now()
+	}
+
+	return m.fileOn
+}
+
+func (m *Maintenance) bypass(req *Request) bool {
+
+	if m.BypassToken != "" {
+		if m.BypassHeader != "" && maintenanceTokenEqual(req.Header.Get(m.BypassHeader), m.BypassToken) {
+			return true
+		}
+		if m.BypassCookie != "" {
+			if v, err := req.Cookie(m.BypassCookie); err == nil && maintenanceTokenEqual(v.Value, m.BypassToken) {
+				return true
+			}
+		}
+	}
+
+	if len(m.BypassIPs) == 0 {
+		return false
+	}
+
+	m.mu.Lock()
+	if m.bypassNets == nil {
+		m.bypassNets = parseIPNetList(m.BypassIPs)
+	}
+	nets := m.bypassNets
+	m.mu.Unlock()
+
+	return nets.matchClient(req)
+}
+
+func maintenanceTokenEqual(v, token string) bool {
+	return v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(token)) == 1
+}
+
+// serve writes the maintenance page, and reports whether it did.
+func (m *Maintenance) serve(s *Service, resp *Response, req *Request) bool {
+
+	if !m.Enabled() || m.bypass(req) {
+		return false
+	}
+
+	var (
+		h    = resp.Header()
+		data = map[string]interface{}{
+			"Message":    m.Message,
+			"RetryAfter": int64(m.RetryAfter / time.Second),
+		}
+		tpl = m.Template
+	)
+
+	if req.cspNonce != "" {
+		data["CSP_NONCE"] = req.cspNonce
+	}
+	if tpl == "" {
+		tpl = defaultMaintenancePage
+	}
+
+	if m.RetryAfter > 0 {
+		h.Set("Retry-After", strconv.FormatInt(int64(m.RetryAfter/time.Second), 10))
+	}
+	h.Set("Cache-Control", "no-store")
+	h.Set("Content-Type", "text/html; charset=utf-8")
+
+	var buf bytes.Buffer
+	if s == nil || s.TemplateLoader == nil ||
+		s.TemplateLoader.rawRender(&buf, tpl, data) != nil {
+		buf.Reset()
+		buf.WriteString("503 Service Unavailable")
+	}
+
+	resp.WriteHeader(http.StatusServiceUnavailable)
+	if req.Method != "HEAD" {
+		resp.Write(buf.Bytes())
+	}
+
+	return true
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+
+	srv := NewService()
+	srv.Maintenance = &Maintenance{
+		RetryAfter:   5 * time.Minute,
+		Message:      "Upgrading the database",
+		BypassIPs:    []string{"10.1.0.0/16"},
+		BypassHeader: "X-Ops-Bypass",
+		BypassCookie: "ops_bypass",
+		BypassToken:  "secret",
+	}
+
+	srv.regHandler(&regHandler{
+		pattern: "/page",
+		handlerAction: &handlerAction{
+			name: "Page",
+			fn: func(ctx Ctx) error {
+				return ctx.JSON(map[string]string{"title": "landing"})
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	serve := func(remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/page/", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		return rec
+	}
+
+	if rec := serve("192.0.2.1:1000", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 while disabled, got %d", rec.Code)
+	}
+
+	srv.Maintenance.Enable()
+
+	rec := serve("192.0.2.1:1000", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while enabled, got %d", rec.Code)
+	}
+	if v := rec.Header().Get("Retry-After"); v != "300" {
+		t.Errorf("expected Retry-After 300, got %q", v)
+	}
+	if !strings.Contains(rec.Body.String(), "Upgrading the database") {
+		t.Errorf("expected the maintenance page, got %q", rec.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		status     int
+	}{
+		{"bypass ip", "10.1.2.3:1000", nil, http.StatusOK},
+		{"bypass header", "192.0.2.1:1000", map[string]string{"X-Ops-Bypass": "secret"}, http.StatusOK},
+		{"bypass cookie", "192.0.2.1:1000", map[string]string{"Cookie": "ops_bypass=secret"}, http.StatusOK},
+		{"wrong token", "192.0.2.1:1000", map[string]string{"X-Ops-Bypass": "guess"}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.remoteAddr, tt.headers); rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+
+	srv.Maintenance.Disable()
+	if rec := serve("192.0.2.1:1000", nil); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 after disable, got %d", rec.Code)
+	}
+}
+
+func TestMaintenanceFile(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "maintenance")
+	m := &Maintenance{File: file}
+
+	if m.Enabled() {
+		t.Fatal("expected disabled without the file")
+	}
+
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m.fileChecked = time.Time{}
+
+	if !m.Enabled() {
+		t.Error("expected enabled with the file")
+	}
+}
@@ -24,26 +24,33 @@ import (
 
 var (
 	DefaultModule = &Module{
-		idxHandlers: make(map[string]*regHandler),
-		routes:      make(map[string]*regRouter),
+		idxHandlers:  make(map[string]*regHandler),
+		routes:       make(map[string]*regRouter),
+		routeConfigs: make(map[string]*RouteConfig),
 	}
 
 	DefaultModules = []*Module{}
 )
 
 type Module struct {
-	Path        string
-	viewpaths   []string
-	viewfss     []http.FileSystem
-	handlers    []*regHandler
-	idxHandlers map[string]*regHandler
-	routes      map[string]*regRouter
+	Path string
+
+	// Config applies to every route of the module.
+	Config RouteConfig
+
+	viewpaths    []string
+	viewfss      []http.FileSystem
+	handlers     []*regHandler
+	idxHandlers  map[string]*regHandler
+	routes       map[string]*regRouter
+	routeConfigs map[string]*RouteConfig
 }
 
 func NewModule() *Module {
 	return &Module{
-		idxHandlers: make(map[string]*regHandler),
-		routes:      make(map[string]*regRouter),
+		idxHandlers:  make(map[string]*regHandler),
+		routes:       make(map[string]*regRouter),
+		routeConfigs: make(map[string]*RouteConfig),
 	}
 }
 
@@ -100,6 +107,24 @@ func (m *Module) SetRoute(pattern string, params map[string]string) {
 	}
 }
 
+// SetRouteConfig overrides the module Config for a single route. The pattern
+// is the one used to register the route, e.g. "/user/login" for the
+// LoginAction of the User controller, or the pattern of RegisterAction.
+func (m *Module) SetRouteConfig(pattern string, cfg RouteConfig) {
+	if m.routeConfigs == nil {
+		m.routeConfigs = make(map[string]*RouteConfig)
+	}
+	m.routeConfigs[filepath.Clean("/"+pattern)] = &cfg
+}
+
+func (m *Module) routeConfig(h *regHandler) *RouteConfig {
+	cfg, ok := m.routeConfigs[filepath.Clean("/"+h.pattern)]
+	if !ok && h.handlerController != nil {
+		cfg = m.routeConfigs[controllerActionPattern(h.handlerController.Name, h.handlerController.ActionName)]
+	}
+	return m.Config.merge(cfg)
+}
+
 func (m *Module) RegisterFileServer(pattern, path string, fs http.FileSystem) {
 	m.handlers = append(m.handlers, &regHandler{
 		pattern: pattern,
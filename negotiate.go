@@ -0,0 +1,244 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hooto/httpsrv/internal/lru"
+)
+
+// A single media range from the Accept HTTP header.
+type acceptMedia struct {
+	Type    string
+	Subtype string
+	Quality float32
+}
+
+// maxAcceptMedia is the number of media ranges read from an Accept header.
+const maxAcceptMedia = 32
+
+var acceptMediaCache = lru.New(1024)
+
+// Accepts returns the one of offers preferred by the Accept header of the
+// request, e.g. "application/json" from
+//
+//	req.Accepts("text/html", "application/json")
+//
+// with "Accept: application/json, text/*;q=0.5". Each offer gets the quality
+// of its most specific media range, and the offers of equal quality are
+// taken in order. It returns the first offer when the request has no valid
+// Accept header, and an empty string when none is acceptable.
+func (req *Request) Accepts(offers ...string) string {
+
+	if len(offers) == 0 {
+		return ""
+	}
+
+	accept := req.acceptMedia()
+	if accept == nil {
+		return offers[0]
+	}
+
+	var (
+		best    string
+		quality float32
+	)
+
+	for _, offer := range offers {
+
+		typ, subtype := splitMediaType(offer)
+
+		var (
+			q           float32
+			specificity = -1
+		)
+		for _, m := range accept {
+			s := 0
+			switch {
+			case m.Type == typ && m.Subtype == subtype:
+				s = 2
+			case m.Type == typ && m.Subtype == "*":
+				s = 1
+			case m.Type == "*" && m.Subtype == "*":
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = m.Quality, s
+			}
+		}
+
+		if q > quality {
+			best, quality = offer, q
+		}
+	}
+
+	return best
+}
+
+// acceptMedia returns the media ranges of the Accept header, sorted by
+// quality, or nil without header or valid range.
+func (req *Request) acceptMedia() []*acceptMedia {
+
+	k := req.Header.Get("Accept")
+	if k == "" {
+		return nil
+	}
+
+	if o, ok := acceptMediaCache.Get(k); ok {
+		return o.([]*acceptMedia)
+	}
+
+	ls := make([]*acceptMedia, 0, 4)
+
+	for _, v := range strings.Split(k, ",") {
+
+		mediaRange, params, _ := strings.Cut(v, ";")
+
+		m := &acceptMedia{
+			Quality: 1,
+		}
+		m.Type, m.Subtype = splitMediaType(mediaRange)
+		if m.Type == "" {
+			continue
+		}
+
+		for params != "" {
+			var param string
+			param, params, _ = strings.Cut(params, ";")
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 32); err == nil && q >= 0 && q <= 1 {
+				m.Quality = float32(q)
+			}
+		}
+
+		if ls = append(ls, m); len(ls) >= maxAcceptMedia {
+			break
+		}
+	}
+
+	// A header without a valid range is ignored, as a missing one.
+	if len(ls) == 0 {
+		ls = nil
+	}
+
+	sort.SliceStable(ls, func(i, j int) bool {
+		return ls[i].Quality > ls[j].Quality
+	})
+
+	if len(k) <= 512 {
+		acceptMediaCache.Add(k, ls)
+	}
+
+	return ls
+}
+
+// splitMediaType returns the type and subtype of a media type without its
+// parameters, e.g. "text" and "html" from "text/html; charset=utf-8".
+func splitMediaType(v string) (string, string) {
+	v, _, _ = strings.Cut(v, ";")
+	typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(v)), "/")
+	if !ok {
+		if typ == "*" {
+			return "*", "*"
+		}
+		return "", ""
+	}
+	return strings.TrimSpace(typ), strings.TrimSpace(subtype)
+}
+
+// Respond renders data in the representation preferred by the Accept header
+// of the request: JSON, XML, the HTML of the action template, which reads
+// data as {{.DATA}}, or plain text. XML is only offered for the values
+// encoding/xml can marshal (not maps), and plain text for a string or a
+// fmt.Stringer. JSON is the default, and a request accepting none of them
+// gets a 406.
+func (c *Controller) Respond(data any) {
+
+	c.AutoRender = false
+	c.Response.Header().Add("Vary", "Accept")
+
+	offers := []string{"application/json"}
+
+	xb, err := xml.Marshal(data)
+	if err == nil {
+		offers = append(offers, "application/xml", "text/xml")
+	}
+	if c.service != nil && c.service.TemplateLoader != nil {
+		offers = append(offers, "text/html")
+	}
+
+	var text string
+	switch v := data.(type) {
+	case string:
+		text = v
+		offers = append(offers, "text/plain")
+	case fmt.Stringer:
+		text = v.String()
+		offers = append(offers, "text/plain")
+	}
+
+	switch typ := c.Request.Accepts(offers...); typ {
+
+	case "application/json":
+		c.RenderJson(data)
+
+	case "application/xml", "text/xml":
+		c.Response.Header().Set("Content-Type", typ+"; charset=utf-8")
+		c.Response.Write([]byte(xml.Header))
+		c.Response.Write(xb)
+
+	case "text/html":
+		c.Data["DATA"] = data
+		c.Render()
+
+	case "text/plain":
+		c.Response.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Response.Write([]byte(text))
+
+	default:
+		c.RenderError(http.StatusNotAcceptable, "406 Not Acceptable")
+	}
+}
+
+func (c *Controller) RenderXml(obj interface{}) {
+	c.renderXml(obj, "application/xml")
+}
+
+func (c *Controller) renderXml(obj any, contentType string) {
+
+	c.AutoRender = false
+
+	bs, err := xml.Marshal(obj)
+	if err != nil {
+		slog.Warn("httpsrv render-xml", "err", err)
+		c.RenderError(http.StatusInternalServerError, "500 Internal Server Error")
+		return
+	}
+
+	c.Response.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	c.Response.Write([]byte(xml.Header))
+	c.Response.Write(bs)
+}
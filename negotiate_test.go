@@ -0,0 +1,155 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestAccepts(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+	}{
+		{"no header", "", []string{"text/html", "application/json"}, "text/html"},
+		{"exact", "application/json", []string{"text/html", "application/json"}, "application/json"},
+		{"quality", "text/html;q=0.5, application/json", []string{"text/html", "application/json"}, "application/json"},
+		{"wildcard subtype", "text/*", []string{"application/json", "text/plain"}, "text/plain"},
+		{"any", "*/*", []string{"application/xml", "application/json"}, "application/xml"},
+		{"specific wins", "text/*;q=0.9, text/html;q=0.1", []string{"text/html", "text/plain"}, "text/plain"},
+		{"refused", "text/html;q=0, */*;q=0.1", []string{"text/html", "application/json"}, "application/json"},
+		{"none acceptable", "image/png", []string{"text/html", "application/json"}, ""},
+		{"offer params", "text/html", []string{"text/html; charset=utf-8"}, "text/html; charset=utf-8"},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", []string{"application/json", "text/html"}, "text/html"},
+		{"invalid quality", "application/json;q=x, text/html;q=0.5", []string{"text/html", "application/json"}, "application/json"},
+		{"case", "Application/JSON", []string{"application/json"}, "application/json"},
+		{"no valid range", "garbage, ;q=1", []string{"text/html", "application/json"}, "text/html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := newRequest(r).Accepts(tt.offers...); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestControllerRespond(t *testing.T) {
+
+	type item struct {
+		ID int `json:"id" xml:"id"`
+	}
+
+	tests := []struct {
+		name        string
+		data        any
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"default", item{ID: 1}, "", 0, "application/json", `{"id":1}`},
+		{"xml", item{ID: 1}, "application/xml", 0, "application/xml; charset=utf-8", "<item><id>1</id></item>"},
+		{"text xml", item{ID: 1}, "text/xml, application/json;q=0.5", 0, "text/xml; charset=utf-8", "<item><id>1</id></item>"},
+		{"text", "hello", "text/plain", 0, "text/plain; charset=utf-8", "hello"},
+		{"text of a struct", item{ID: 1}, "text/plain", http.StatusNotAcceptable, "text/html; charset=utf-8", "406 Not Acceptable"},
+		{"xml of a map", map[string]int{"id": 1}, "application/xml, application/json;q=0.5", 0, "application/json", `{"id":1}`},
+		{"only xml of a map", map[string]int{"id": 1}, "application/xml", http.StatusNotAcceptable, "text/html; charset=utf-8", "406 Not Acceptable"},
+		{"not acceptable", item{ID: 1}, "image/png", http.StatusNotAcceptable, "text/html; charset=utf-8", "406 Not Acceptable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			c := newController(nil, newRequest(r), newResponse(rec))
+
+			c.Respond(tt.data)
+
+			if c.Response.Status != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, c.Response.Status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, ct)
+			}
+			if body := c.Response.buf.String(); !strings.Contains(body, tt.body) {
+				t.Errorf("expected body %q, got %q", tt.body, body)
+			}
+			if rec.Header().Get("Vary") != "Accept" {
+				t.Errorf("expected Vary: Accept, got %q", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCtxNegotiate(t *testing.T) {
+
+	offers := func(ctx Ctx) []Offer {
+		return []Offer{
+			{"text/plain", func() error { return ctx.Send([]byte("id 1")) }},
+			{"application/json", func() error { return ctx.JSON(map[string]int{"id": 1}) }},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+		status int
+		body   string
+	}{
+		{"no header", "", 0, "id 1"},
+		{"invalid header", "garbage", 0, "id 1"},
+		{"json", "application/*", 0, `{"id":1}`},
+		{"tie in offer order", "application/json, text/plain", 0, "id 1"},
+		{"not acceptable", "image/png", http.StatusNotAcceptable, "406 Not Acceptable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			c := newController(nil, newRequest(r), newResponse(httptest.NewRecorder()))
+			ctx := &ctxImpl{c: c}
+
+			if err := ctx.Negotiate(offers(ctx)...); err != nil {
+				t.Fatal(err)
+			}
+			if c.Response.Status != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, c.Response.Status)
+			}
+			if body := c.Response.buf.String(); body != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, body)
+			}
+		})
+	}
+}
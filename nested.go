@@ -0,0 +1,272 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Nested returns the query and form values with the bracket keys sent by
+// PHP, Rails or jQuery clients parsed into nested maps and slices, e.g.
+//
+//	user[name]=x&user[tags][]=a&user[tags][]=b&items[0][id]=3
+//
+// gives
+//
+//	map[string]any{
+//		"user":  map[string]any{"name": "x", "tags": []any{"a", "b"}},
+//		"items": []any{map[string]any{"id": "3"}},
+//	}
+//
+// The slices hold the elements ordered by index and packed, e.g.
+// rows[2]=a&rows[9]=b gives []any{"a", "b"}, so a large index does not
+// allocate a large slice. A key with several values gives a []any of
+// strings. Params.Bind reads the bracket keys by their dotted name, e.g.
+// "user.name" or "items.0.id", the other accessors by the key as sent, e.g.
+// "user[name]".
+func (p *Params) Nested() map[string]any {
+
+	tree := map[string]any{}
+	if p.request == nil {
+		return tree
+	}
+	p.init()
+
+	for _, vs := range p.sourceValues() {
+		// Insert the keys in order, for the nodes to get a stable shape.
+		keys := make([]string, 0, len(vs))
+		for k := range vs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			nestedInsert(tree, bracketSegments(k), vs[k])
+		}
+	}
+
+	return nestedSlices(tree).(map[string]any)
+}
+
+// Map returns the nested values under key, or nil, see Nested.
+func (p *Params) Map(key string) map[string]any {
+	m, _ := p.Nested()[key].(map[string]any)
+	return m
+}
+
+// sourceValues returns the query and form values of the source of p.
+func (p *Params) sourceValues() []url.Values {
+	var ls []url.Values
+	if p.source == "" || p.source == "query" {
+		ls = append(ls, p.values)
+	}
+	if p.source == "" || p.source == "form" {
+		ls = append(ls, p.request.PostForm)
+	}
+	return ls
+}
+
+// bracketSegments splits "a[b][]" into "a", "b" and "". A malformed key is
+// returned as a single segment.
+func bracketSegments(k string) []string {
+
+	i := strings.IndexByte(k, '[')
+	if i <= 0 {
+		return []string{k}
+	}
+
+	segs := []string{k[:i]}
+	for rest := k[i:]; rest != ""; {
+		j := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || j < 0 {
+			return []string{k}
+		}
+		segs = append(segs, rest[1:j])
+		rest = rest[j+1:]
+	}
+
+	return segs
+}
+
+// bracketPath returns the dotted name of a bracket key, e.g. "user.tags" for
+// "user[tags][]".
+func bracketPath(k string) string {
+	segs := bracketSegments(k)
+	if n := len(segs); n > 1 && segs[n-1] == "" {
+		segs = segs[:n-1]
+	}
+	return strings.Join(segs, ".")
+}
+
+// nestedValues returns the values of name in vs, or else of the bracket key
+// with the dotted name.
+func nestedValues(vs url.Values, name string) []string {
+	if v, ok := vs[name]; ok {
+		return v
+	}
+	for k, v := range vs {
+		if strings.IndexByte(k, '[') > 0 && bracketPath(k) == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func nestedInsert(m map[string]any, segs []string, vals []string) {
+
+	for i, n := 0, len(segs); i < n-1; i++ {
+
+		if i == n-2 && segs[n-1] == "" {
+			// "a[]", a list of values
+			ls, _ := m[segs[i]].([]any)
+			for _, v := range vals {
+				ls = append(ls, v)
+			}
+			m[segs[i]] = ls
+			return
+		}
+
+		child, ok := m[segs[i]].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			m[segs[i]] = child
+		}
+		m = child
+	}
+
+	if len(vals) == 1 {
+		m[segs[len(segs)-1]] = vals[0]
+	} else {
+		ls := make([]any, len(vals))
+		for i, v := range vals {
+			ls[i] = v
+		}
+		m[segs[len(segs)-1]] = ls
+	}
+}
+
+// nestedSlices turns the maps with index keys into slices, ordered by index
+// and without the missing indexes.
+func nestedSlices(v any) any {
+
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+
+	indexes := make([]int, 0, len(m))
+	for k, child := range m {
+		m[k] = nestedSlices(child)
+		if i, err := strconv.Atoi(k); err == nil && i >= 0 && indexes != nil {
+			indexes = append(indexes, i)
+		} else {
+			indexes = nil
+		}
+	}
+
+	if len(indexes) == 0 || len(indexes) != len(m) {
+		return m
+	}
+
+	sort.Ints(indexes)
+	ls := make([]any, len(indexes))
+	for n, i := range indexes {
+		ls[n] = m[strconv.Itoa(i)]
+	}
+	return ls
+}
+
+// nestedIndexes returns the sorted indexes of the values of the list name,
+// e.g. 0 and 1 for "items[0][id]" and "items[1][id]".
+func (p *Params) nestedIndexes(from, name string) []int {
+
+	var (
+		prefix = name + "."
+		seen   = map[int]bool{}
+		ls     []int
+	)
+
+	for _, vs := range p.bindSources(from) {
+		for k := range vs {
+			k = bracketPath(k)
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			seg, _, _ := strings.Cut(k[len(prefix):], ".")
+			if i, err := strconv.Atoi(seg); err == nil && i >= 0 && !seen[i] {
+				seen[i] = true
+				ls = append(ls, i)
+			}
+		}
+	}
+
+	sort.Ints(ls)
+	return ls
+}
+
+// nestedKeys returns the sorted keys of the map name, e.g. "color" for
+// "meta[color]".
+func (p *Params) nestedKeys(from, name string) []string {
+
+	var (
+		prefix = name + "."
+		seen   = map[string]bool{}
+		ls     []string
+	)
+
+	for _, vs := range p.bindSources(from) {
+		for k := range vs {
+			k = bracketPath(k)
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			if key := k[len(prefix):]; key != "" && !strings.Contains(key, ".") && !seen[key] {
+				seen[key] = true
+				ls = append(ls, key)
+			}
+		}
+	}
+
+	sort.Strings(ls)
+	return ls
+}
+
+// hasNestedKeys reports whether a value name starts with prefix, e.g.
+// "parent." for "parent[name]".
+func (p *Params) hasNestedKeys(from, prefix string) bool {
+	for _, vs := range p.bindSources(from) {
+		for k := range vs {
+			if strings.HasPrefix(bracketPath(k), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bindSources returns the query and form values of a bind source.
+func (p *Params) bindSources(from string) []url.Values {
+	switch from {
+	case "":
+		return []url.Values{p.values, p.request.PostForm}
+	case "query":
+		return []url.Values{p.values}
+	case "form":
+		return []url.Values{p.request.PostForm}
+	}
+	return nil
+}
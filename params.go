@@ -15,9 +15,15 @@
 package httpsrv
 
 import (
+	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Params struct {
@@ -27,15 +33,28 @@ type Params struct {
 	values url.Values
 
 	request *http.Request
+
+	// optional, provides the multipart limits of the route
+	req *Request
+
+	// the only source of the values of a view, see Path, Query and Form
+	source string
+
+	// the struct types being bound, to stop the recursive types
+	binding map[reflect.Type]bool
 }
 
+const defaultMultipartMemory = 32 << 20 // 32 MB
+
 func ParamsFilter(c *Controller) {
 	if c.Params == nil {
 		c.Params = &Params{
 			request: c.Request.Request,
+			req:     c.Request,
 		}
 	} else {
 		c.Params.request = c.Request.Request
+		c.Params.req = c.Request
 	}
 }
 
@@ -53,14 +72,115 @@ func (p *Params) init() {
 	p.inited = true
 	if p.request != nil {
 		p.values = p.request.URL.Query()
-		if p.request.Method == "POST" ||
-			p.request.Method == "PUT" ||
-			p.request.Method == "PATCH" {
+		// The streamed bodies are left to the handler.
+		if p.req == nil || !p.req.streamBody {
+			p.parseBody()
+		}
+	}
+}
+
+func (p *Params) parseBody() {
+	if p.request.Method == "POST" ||
+		p.request.Method == "PUT" ||
+		p.request.Method == "PATCH" {
+		if strings.HasPrefix(p.request.Header.Get("Content-Type"), "multipart/form-data") {
+			p.parseMultipart()
+		} else {
 			p.request.ParseForm()
 		}
 	}
 }
 
+func (p *Params) parseMultipart() {
+
+	var maxMemory, maxFileSize int64 = defaultMultipartMemory, 0
+	if p.req != nil {
+		if p.req.maxMultipartMemory > 0 {
+			maxMemory = p.req.maxMultipartMemory
+		}
+		maxFileSize = p.req.maxFileSize
+	}
+
+	if maxFileSize <= 0 {
+		if err := p.request.ParseMultipartForm(maxMemory); err != nil && p.req != nil {
+			p.req.setBodyErr(err)
+		}
+		return
+	}
+
+	form, err := readMultipartForm(p.request, maxMemory, maxFileSize)
+	if err != nil {
+		if p.req != nil {
+			p.req.setBodyErr(err)
+		}
+		return
+	}
+
+	// As ParseMultipartForm, with the query values in Form.
+	p.request.ParseForm()
+	if p.request.PostForm == nil {
+		p.request.PostForm = make(url.Values)
+	}
+	for k, v := range form.Value {
+		p.request.Form[k] = append(p.request.Form[k], v...)
+		p.request.PostForm[k] = append(p.request.PostForm[k], v...)
+	}
+	p.request.MultipartForm = form
+}
+
+// readMultipartForm reads the multipart form of r as ParseMultipartForm, but
+// fails with a *http.MaxBytesError as soon as a file exceeds maxFileSize,
+// before the rest of the body is read.
+func readMultipartForm(r *http.Request, maxMemory, maxFileSize int64) (*multipart.Form, error) {
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pr, pw = io.Pipe()
+		mw     = multipart.NewWriter(pw)
+	)
+
+	go func() {
+		pw.CloseWithError(copyMultipart(mw, mr, maxFileSize))
+	}()
+
+	form, err := multipart.NewReader(pr, mw.Boundary()).ReadForm(maxMemory)
+	pr.CloseWithError(err)
+
+	var e *http.MaxBytesError
+	if errors.As(err, &e) {
+		return nil, e
+	}
+	return form, err
+}
+
+// copyMultipart copies the parts of mr to mw, the files limited to maxFileSize.
+func copyMultipart(mw *multipart.Writer, mr *multipart.Reader, maxFileSize int64) error {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return mw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		w, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		var r io.Reader = part
+		if part.FileName() != "" {
+			r = &limitedPartReader{r: part, n: maxFileSize}
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *Params) SetValue(key, value string) {
 	p.init()
 	if p.values == nil {
@@ -69,24 +189,234 @@ func (p *Params) SetValue(key, value string) {
 	p.values.Set(key, value)
 }
 
-func (p *Params) Value(key string) string {
+// Path returns a view of the path values only.
+func (p *Params) Path() *Params {
+	return p.view("path")
+}
+
+// Query returns a view of the query values only.
+func (p *Params) Query() *Params {
+	return p.view("query")
+}
+
+// Form returns a view of the form values of the body only.
+func (p *Params) Form() *Params {
+	return p.view("form")
+}
+
+func (p *Params) view(source string) *Params {
+	if p.request != nil {
+		p.init()
+	}
+	return &Params{
+		inited:  true,
+		values:  p.values,
+		request: p.request,
+		req:     p.req,
+		source:  source,
+	}
+}
+
+// lookup returns the values of key, from the first source holding it of the
+// path, query and form.
+func (p *Params) lookup(key string) []string {
 	if p.request == nil {
-		return ""
+		return nil
 	}
 	p.init()
-	if v := p.request.PathValue(key); v != "" {
-		return v
+	vs, _ := p.sourceLookup(p.source, key, func(vs url.Values, name string) []string {
+		return vs[name]
+	})
+	return vs
+}
+
+func (p *Params) Value(key string) string {
+	if vs := p.lookup(key); len(vs) > 0 {
+		return vs[0]
 	}
-	if p.values != nil && p.values.Has(key) {
-		return p.values.Get(key)
+	return ""
+}
+
+// Values returns all the values of key.
+func (p *Params) Values(key string) []string {
+	return p.lookup(key)
+}
+
+func (p *Params) Has(key string) bool {
+	return len(p.lookup(key)) > 0
+}
+
+// ValueOr returns the value of key, or def when there is none.
+func (p *Params) ValueOr(key, def string) string {
+	if vs := p.lookup(key); len(vs) > 0 {
+		return vs[0]
 	}
-	if p.request.Form != nil && p.request.Form.Has(key) {
-		return p.request.Form.Get(key)
+	return def
+}
+
+// Strings returns the values of key, repeated or comma-separated, e.g.
+// "?tag=a,b&tag=c" gives a, b and c.
+func (p *Params) Strings(key string) []string {
+	var ls []string
+	for _, v := range p.lookup(key) {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				ls = append(ls, item)
+			}
+		}
 	}
-	if p.request.PostForm != nil && p.request.PostForm.Has(key) {
-		return p.request.PostForm.Get(key)
+	return ls
+}
+
+// value returns the first value of key, or an error for a missing key.
+func (p *Params) value(key string) (string, error) {
+	vs := p.lookup(key)
+	if len(vs) == 0 || vs[0] == "" {
+		return "", &FieldError{Field: key, Rule: "required", Err: ErrParamMissing}
 	}
-	return ""
+	return vs[0], nil
+}
+
+func paramError(key, value string, err error) error {
+	return &FieldError{Field: key, Value: value, Err: err}
+}
+
+func (p *Params) Int(key string) (int64, error) {
+	s, err := p.value(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, paramError(key, s, err)
+	}
+	return i, nil
+}
+
+func (p *Params) Uint(key string) (uint64, error) {
+	s, err := p.value(key)
+	if err != nil {
+		return 0, err
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, paramError(key, s, err)
+	}
+	return u, nil
+}
+
+func (p *Params) Float(key string) (float64, error) {
+	s, err := p.value(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, paramError(key, s, err)
+	}
+	return f, nil
+}
+
+// Bool accepts the values of strconv.ParseBool, and on/off, yes/no.
+func (p *Params) Bool(key string) (bool, error) {
+	s, err := p.value(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := parseBool(s)
+	if err != nil {
+		return false, paramError(key, s, err)
+	}
+	return b, nil
+}
+
+func (p *Params) Duration(key string) (time.Duration, error) {
+	s, err := p.value(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, paramError(key, s, err)
+	}
+	return d, nil
+}
+
+// Time parses the value of key with the layouts, by default RFC 3339 and
+// the date and time formats "2006-01-02 15:04:05" and "2006-01-02".
+func (p *Params) Time(key string, layouts ...string) (time.Time, error) {
+	s, err := p.value(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(layouts) == 0 {
+		layouts = bindTimeLayouts
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, paramError(key, s, errors.New("invalid time"))
+}
+
+// Ints returns the values of key as integers, see Strings.
+func (p *Params) Ints(key string) ([]int64, error) {
+	var ls []int64
+	for _, s := range p.Strings(key) {
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, paramError(key, s, err)
+		}
+		ls = append(ls, i)
+	}
+	return ls, nil
+}
+
+// IntOr returns the integer value of key, or def when it is missing or invalid.
+func (p *Params) IntOr(key string, def int64) int64 {
+	if i, err := p.Int(key); err == nil {
+		return i
+	}
+	return def
+}
+
+func (p *Params) UintOr(key string, def uint64) uint64 {
+	if u, err := p.Uint(key); err == nil {
+		return u
+	}
+	return def
+}
+
+func (p *Params) FloatOr(key string, def float64) float64 {
+	if f, err := p.Float(key); err == nil {
+		return f
+	}
+	return def
+}
+
+func (p *Params) BoolOr(key string, def bool) bool {
+	if b, err := p.Bool(key); err == nil {
+		return b
+	}
+	return def
+}
+
+func (p *Params) DurationOr(key string, def time.Duration) time.Duration {
+	if d, err := p.Duration(key); err == nil {
+		return d
+	}
+	return def
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
 }
 
 func (p *Params) IntValue(key string) int64 {
@@ -15,10 +15,13 @@
 package httpsrv
 
 import (
+	"errors"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParamsValue(t *testing.T) {
@@ -192,3 +195,107 @@ func TestParamsFilter(t *testing.T) {
 		t.Error("Params should be initialized")
 	}
 }
+
+func TestParamsTypedValues(t *testing.T) {
+
+	r := httptest.NewRequest("POST", "/items/7?id=query&tag=a,b&tag=c&n=42&u=-1&f=1.5&on=on&d=90s"+
+		"&day=2024-05-01&ids=1,2,3&bad=x", strings.NewReader("id=form&title=doc"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetPathValue("id", "path")
+
+	p := &Params{request: r}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"values", len(p.Values("tag")) == 2},
+		{"strings", strings.Join(p.Strings("tag"), "|") == "a|b|c"},
+		{"has", p.Has("title") && !p.Has("missing")},
+		{"value or", p.ValueOr("missing", "def") == "def"},
+		{"int or", p.IntOr("n", 0) == 42 && p.IntOr("bad", 5) == 5 && p.IntOr("missing", 6) == 6},
+		{"uint or", p.UintOr("u", 9) == 9},
+		{"float or", p.FloatOr("f", 0) == 1.5},
+		{"bool or", p.BoolOr("on", false) && p.BoolOr("missing", true)},
+		{"duration or", p.DurationOr("d", 0) == 90*time.Second},
+		{"path source", p.Value("id") == "path" && p.Path().Value("id") == "path"},
+		{"query source", p.Query().Value("id") == "query" && !p.Query().Has("title")},
+		{"form source", p.Form().Value("id") == "form" && !p.Form().Has("n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.ok {
+				t.Error("unexpected value")
+			}
+		})
+	}
+
+	if day, err := p.Time("day"); err != nil || day.Day() != 1 {
+		t.Errorf("expected a date, got %v %v", day, err)
+	}
+	if ids, err := p.Ints("ids"); err != nil || len(ids) != 3 || ids[2] != 3 {
+		t.Errorf("expected 3 ints, got %v %v", ids, err)
+	}
+
+	if _, err := p.Int("missing"); !errors.Is(err, ErrParamMissing) {
+		t.Errorf("expected ErrParamMissing, got %v", err)
+	}
+	var fe *FieldError
+	if _, err := p.Int("bad"); !errors.As(err, &fe) || fe.Field != "bad" || fe.Value != "x" {
+		t.Errorf("expected a field error, got %v", err)
+	}
+}
+
+func TestParamsNested(t *testing.T) {
+
+	form := url.Values{}
+	form.Add("user[name]", "x")
+	form.Add("user[tags][]", "a")
+	form.Add("user[tags][]", "b")
+	form.Add("items[1][id]", "4")
+	form.Add("items[0][id]", "3")
+	form.Add("rows[9]", "b")
+	form.Add("rows[2]", "a")
+	form.Add("plain", "y")
+	form.Add("broken[key", "z")
+
+	req := httptest.NewRequest("POST", "/?filter[status]=open", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	p := &Params{request: req}
+	got := p.Nested()
+
+	want := map[string]any{
+		"user":       map[string]any{"name": "x", "tags": []any{"a", "b"}},
+		"items":      []any{map[string]any{"id": "3"}, map[string]any{"id": "4"}},
+		"rows":       []any{"a", "b"}, // sparse indexes are packed
+		"plain":      "y",
+		"broken[key": "z",
+		"filter":     map[string]any{"status": "open"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"map", p.Map("filter")["status"], "open"},
+		{"map of a value", p.Map("plain") == nil, true},
+		{"query view", len(p.Query().Nested()), 1},
+		{"exact value", p.Value("user[name]"), "x"},
+		{"exact list", p.Strings("user[tags][]"), []string{"a", "b"}},
+		{"no dotted value", p.Has("user.name") || p.Value("items.1.id") != "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, tt.got)
+			}
+		})
+	}
+}
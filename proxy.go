@@ -0,0 +1,261 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ipNetList is a parsed set of IP addresses and CIDR blocks.
+// The special entry "unix" matches peers connected through a unix socket.
+type ipNetList struct {
+	nets []*net.IPNet
+	unix bool
+}
+
+func parseIPNetList(items []string) *ipNetList {
+
+	ls := &ipNetList{}
+
+	for _, v := range items {
+
+		v = strings.TrimSpace(v)
+		if v == "" || v[0] == '#' {
+			continue
+		}
+
+		if v == "unix" {
+			ls.unix = true
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil {
+				if ip4 := ip.To4(); ip4 != nil {
+					v += "/32"
+				} else {
+					v += "/128"
+				}
+			}
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			slog.Warn("httpsrv invalid ip/cidr", "value", v, "err", err)
+			continue
+		}
+		ls.nets = append(ls.nets, n)
+	}
+
+	return ls
+}
+
+func (it *ipNetList) empty() bool {
+	return it == nil || (len(it.nets) == 0 && !it.unix)
+}
+
+func (it *ipNetList) contains(ip net.IP) bool {
+	if it == nil || ip == nil {
+		return false
+	}
+	for _, n := range it.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the peer address (as found in http.Request.RemoteAddr)
+// belongs to the list.
+func (it *ipNetList) match(remoteAddr string) bool {
+	if it == nil {
+		return false
+	}
+	if isUnixRemoteAddr(remoteAddr) {
+		return it.unix
+	}
+	return it.contains(net.ParseIP(remoteIP(remoteAddr)))
+}
+
+// Unix socket peers have no network address, net/http reports them as "@" or "".
+func isUnixRemoteAddr(addr string) bool {
+	return addr == "" || addr == "@"
+}
+
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func (s *Service) trustedProxies() *ipNetList {
+	s.mu.RLock()
+	ls := s.proxies
+	s.mu.RUnlock()
+	if ls != nil {
+		return ls
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxies == nil {
+		s.proxies = parseIPNetList(s.Config.TrustedProxies)
+	}
+	return s.proxies
+}
+
+// forwardedHop is a hop of the forwarding headers: the address of the peer
+// of a proxy, and the protocol and host of the request it received.
+type forwardedHop struct {
+	addr, proto, host string
+}
+
+// resolveProxy applies the forwarding headers of a request that was received
+// from a trusted proxy. The RFC 7239 Forwarded header takes precedence over
+// the X-Forwarded-For/Proto/Host and X-Real-IP headers.
+//
+// The chain is walked from the nearest hop, and the protocol and host are the
+// ones of the hop where the walk stops, the headers of the previous hops may
+// be set by the client.
+func (req *Request) resolveProxy(proxies *ipNetList) {
+
+	if proxies.empty() || !proxies.match(req.RemoteAddr) {
+		return
+	}
+
+	var (
+		hops          []forwardedHop
+		realIP        = strings.TrimSpace(req.Header.Get("X-Real-IP"))
+		forwarded, ok = req.Header["Forwarded"]
+	)
+
+	if ok {
+		hops = parseForwarded(forwarded)
+	} else {
+		hops = parseXForwarded(req.Header)
+	}
+	if len(hops) == 0 {
+		hops = []forwardedHop{{}}
+	}
+
+	// Walk the chain from the nearest hop, the first untrusted address is the client.
+	stop := len(hops) - 1
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(remoteIP(hops[i].addr))
+		if ip == nil {
+			break
+		}
+		req.clientIP, stop = ip.String(), i
+		if !proxies.contains(ip) {
+			break
+		}
+	}
+
+	if req.clientIP == "" && realIP != "" {
+		if ip := net.ParseIP(remoteIP(realIP)); ip != nil {
+			req.clientIP = ip.String()
+		}
+	}
+
+	switch proto := strings.ToLower(strings.TrimSpace(hops[stop].proto)); proto {
+	case "http", "https":
+		if proto != req.Scheme() {
+			req.scheme, req.forwardedOrigin = proto, true
+		}
+	}
+
+	if host := strings.TrimSpace(hops[stop].host); host != "" && host != req.Host {
+		req.Host, req.forwardedOrigin = host, true
+	}
+}
+
+// parseForwarded parses the RFC 7239 Forwarded header values into their
+// elements, in order.
+func parseForwarded(values []string) []forwardedHop {
+
+	var hops []forwardedHop
+
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				v = strings.Trim(strings.TrimSpace(v), `"`)
+				switch strings.ToLower(k) {
+				case "for":
+					hop.addr = v
+				case "proto":
+					hop.proto = v
+				case "host":
+					hop.host = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// parseXForwarded parses the X-Forwarded-For/Proto/Host headers. The
+// protocols and hosts are matched to the addresses when each proxy appended
+// one, otherwise every hop gets the right-most ones.
+func parseXForwarded(h http.Header) []forwardedHop {
+
+	var (
+		fors   = splitHeaderList(h.Values("X-Forwarded-For"))
+		protos = splitHeaderList(h.Values("X-Forwarded-Proto"))
+		hosts  = splitHeaderList(h.Values("X-Forwarded-Host"))
+		hops   = make([]forwardedHop, max(len(fors), 1))
+	)
+
+	for i := range hops {
+		if i < len(fors) {
+			hops[i].addr = fors[i]
+		}
+		if len(protos) == len(hops) {
+			hops[i].proto = protos[i]
+		} else if len(protos) > 0 {
+			hops[i].proto = protos[len(protos)-1]
+		}
+		if len(hosts) == len(hops) {
+			hops[i].host = hosts[i]
+		} else if len(hosts) > 0 {
+			hops[i].host = hosts[len(hosts)-1]
+		}
+	}
+
+	return hops
+}
+
+// splitHeaderList returns the non-empty items of comma-separated header values.
+func splitHeaderList(values []string) []string {
+	var ls []string
+	for _, v := range values {
+		for _, v2 := range strings.Split(v, ",") {
+			if v2 = strings.TrimSpace(v2); v2 != "" {
+				ls = append(ls, v2)
+			}
+		}
+	}
+	return ls
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestResolveProxy(t *testing.T) {
+
+	proxies := parseIPNetList([]string{"10.0.0.0/8", "127.0.0.1", "unix"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		tls        bool
+		wantIP     string
+		wantScheme string
+		wantHost   string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https"},
+			wantIP:     "192.0.2.1",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "direct tls client",
+			remoteAddr: "192.0.2.1:1234",
+			tls:        true,
+			wantIP:     "192.0.2.1",
+			wantScheme: "https",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "x-forwarded chain",
+			remoteAddr: "127.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "203.0.113.9, 198.51.100.7, 10.1.2.3",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "www.example.com",
+			},
+			wantIP:     "198.51.100.7",
+			wantScheme: "https",
+			wantHost:   "www.example.com",
+		},
+		{
+			name:       "x-real-ip",
+			remoteAddr: "10.0.0.2:1234",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.8"},
+			wantIP:     "198.51.100.8",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "rfc 7239 forwarded",
+			remoteAddr: "10.0.0.2:1234",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::1]:4711";proto=https;host=api.example.com, for=10.0.0.3`,
+				"X-Forwarded-For": "198.51.100.7",
+			},
+			wantIP:     "2001:db8::1",
+			wantScheme: "https",
+			wantHost:   "api.example.com",
+		},
+		{
+			name:       "forwarded spoofed by the client",
+			remoteAddr: "10.0.0.2:1234",
+			headers: map[string]string{
+				"Forwarded": `for=192.0.2.60;proto=http;host=evil.example, for=198.51.100.7;proto=https;host=www.example.com`,
+			},
+			wantIP:     "198.51.100.7",
+			wantScheme: "https",
+			wantHost:   "www.example.com",
+		},
+		{
+			name:       "x-forwarded spoofed by the client",
+			remoteAddr: "10.0.0.2:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "192.0.2.60, 198.51.100.7",
+				"X-Forwarded-Proto": "http, https",
+				"X-Forwarded-Host":  "evil.example, www.example.com",
+			},
+			wantIP:     "198.51.100.7",
+			wantScheme: "https",
+			wantHost:   "www.example.com",
+		},
+		{
+			name:       "x-forwarded right-most values",
+			remoteAddr: "10.0.0.2:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "198.51.100.7",
+				"X-Forwarded-Proto": "http, https",
+				"X-Forwarded-Host":  "evil.example, www.example.com",
+			},
+			wantIP:     "198.51.100.7",
+			wantScheme: "https",
+			wantHost:   "www.example.com",
+		},
+		{
+			name:       "unix socket peer",
+			remoteAddr: "@",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https"},
+			wantIP:     "198.51.100.7",
+			wantScheme: "https",
+			wantHost:   "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/test", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			req := newRequest(r)
+			req.resolveProxy(proxies)
+
+			if got := req.ClientIP(); got != tt.wantIP {
+				t.Errorf("expected client ip %q, got %q", tt.wantIP, got)
+			}
+			if got := req.Scheme(); got != tt.wantScheme {
+				t.Errorf("expected scheme %q, got %q", tt.wantScheme, got)
+			}
+			if req.Host != tt.wantHost {
+				t.Errorf("expected host %q, got %q", tt.wantHost, req.Host)
+			}
+		})
+	}
+}
+
+func TestControllerUrlBaseProxy(t *testing.T) {
+	srv := NewService()
+	srv.Config.TrustedProxies = []string{"127.0.0.1"}
+
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.RemoteAddr = "127.0.0.1:5678"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "www.example.com")
+
+	req := newRequest(r)
+	req.resolveProxy(srv.trustedProxies())
+
+	c := newController(srv, req, newResponse(httptest.NewRecorder()))
+
+	if got := c.UrlBase("user/login"); got != "https://www.example.com/user/login" {
+		t.Errorf("unexpected url base %q", got)
+	}
+
+	c.Redirect("/user/login")
+	if got := c.Response.Header().Get("Location"); got != "https://www.example.com/user/login" {
+		t.Errorf("unexpected redirect location %q", got)
+	}
+}
+
+func TestControllerRedirectRelative(t *testing.T) {
+	srv := NewService()
+
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set("X-Forwarded-Host", "evil.example")
+
+	req := newRequest(r)
+	req.resolveProxy(srv.trustedProxies())
+
+	c := newController(srv, req, newResponse(httptest.NewRecorder()))
+
+	c.Redirect("/user/login")
+	if got := c.Response.Header().Get("Location"); got != "/user/login" {
+		t.Errorf("expected a relative location, got %q", got)
+	}
+}
@@ -16,6 +16,7 @@ package httpsrv
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -38,8 +39,22 @@ type Request struct {
 	urlPath      string
 	urlRoutePath string
 
+	service *Service
+
+	clientIP string
+	scheme   string
+	cspNonce string
+
+	// set when trusted proxy headers changed the scheme or host
+	forwardedOrigin bool
+
 	bodyRead   bool
 	bodyBuffer bytes.Buffer
+	bodyErr    error
+	streamBody bool
+
+	maxMultipartMemory int64
+	maxFileSize        int64
 }
 
 // A single language from the Accept-Language HTTP header.
@@ -52,35 +67,101 @@ var acceptLanguageCache = lru.New(1024)
 
 func newRequest(r *http.Request) *Request {
 
-	req := &Request{
-		Request:        r,
-		ContentType:    resolveContentType(r),
-		acceptLanguage: resolveAcceptLanguage(r),
-		Locale:         "",
-		bodyRead:       false,
-	}
+	req := newStreamRequest(r)
+	req.streamBody = false
 
 	if req.ContentType == "application/x-www-form-urlencoded" &&
 		(r.Method == "POST" || r.Method == "PUT") && req.Body != nil {
 		if _, err := io.Copy(&req.bodyBuffer, req.Body); err == nil {
 			req.Body = io.NopCloser(bytes.NewReader(req.bodyBuffer.Bytes()))
 			req.bodyRead = true
+		} else {
+			req.setBodyErr(err)
 		}
 	}
 
 	return req
 }
 
+// newStreamRequest returns a request whose body is left to the handler, see
+// RouteConfig.StreamBody.
+func newStreamRequest(r *http.Request) *Request {
+	return &Request{
+		Request:        r,
+		ContentType:    resolveContentType(r),
+		acceptLanguage: resolveAcceptLanguage(r),
+		streamBody:     true,
+	}
+}
+
+// RawBody returns the whole body of the request, or nil on a route with
+// RouteConfig.StreamBody.
 func (req *Request) RawBody() []byte {
-	if !req.bodyRead && req.Body != nil {
+	if !req.bodyRead && req.Body != nil && !req.streamBody {
 		if _, err := io.Copy(&req.bodyBuffer, req.Body); err != nil {
 			req.bodyBuffer.Reset()
+			req.setBodyErr(err)
 		}
 		req.bodyRead = true
 	}
 	return req.bodyBuffer.Bytes()
 }
 
+// BodyReader returns the body of the request for an incremental read. The
+// progress function, if not nil, gets the bytes read so far and the
+// Content-Length, -1 when unknown, after each read. A read over the body
+// limit answers the request with a 413.
+func (req *Request) BodyReader(progress func(read, total int64)) io.Reader {
+	return &bodyReader{
+		req:      req,
+		progress: progress,
+	}
+}
+
+type bodyReader struct {
+	req      *Request
+	progress func(read, total int64)
+	read     int64
+}
+
+func (br *bodyReader) Read(b []byte) (int, error) {
+	if br.req.Body == nil {
+		return 0, io.EOF
+	}
+	n, err := br.req.Body.Read(b)
+	if br.read += int64(n); br.progress != nil && n > 0 {
+		br.progress(br.read, br.req.ContentLength)
+	}
+	if err != nil && err != io.EOF {
+		br.req.setBodyErr(err)
+	}
+	return n, err
+}
+
+func (req *Request) setBodyErr(err error) {
+	if req.bodyErr == nil {
+		req.bodyErr = err
+	}
+}
+
+// bodyTooLarge reports whether the body exceeded one of the size limits.
+func (req *Request) bodyTooLarge() bool {
+	var e *http.MaxBytesError
+	return req.bodyErr != nil && errors.As(req.bodyErr, &e)
+}
+
+// bodyStatus returns the status of a rejected body, 413 over a size limit or
+// 415 for an unsupported encoding, or 0.
+func (req *Request) bodyStatus() int {
+	switch {
+	case req.bodyTooLarge():
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(req.bodyErr, ErrUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType
+	}
+	return 0
+}
+
 func (req *Request) UrlPath() string {
 	if req.urlPath == "" {
 		req.urlPath = filepath.Clean("/" + req.Request.URL.Path)
@@ -93,19 +174,39 @@ func (req *Request) UrlRoutePath() string {
 }
 
 func (req *Request) RawAbsUrl() string {
+	return fmt.Sprintf("%s://%s%s", req.Scheme(), req.Host, req.RequestURI)
+}
 
-	scheme := "http"
-
-	if len(req.URL.Scheme) > 0 {
-		scheme = req.URL.Scheme
+// ClientIP returns the IP address of the client. When the request comes from
+// one of Config.TrustedProxies, the address is taken from the forwarding headers.
+func (req *Request) ClientIP() string {
+	if req.clientIP == "" {
+		req.clientIP = remoteIP(req.RemoteAddr)
 	}
+	return req.clientIP
+}
 
-	return fmt.Sprintf("%s://%s%s", scheme, req.Host, req.RequestURI)
+// Scheme returns "https" or "http" as seen by the client, honoring the
+// forwarded protocol of a trusted proxy.
+func (req *Request) Scheme() string {
+	if req.scheme == "" {
+		if req.TLS != nil {
+			req.scheme = "https"
+		} else if req.URL != nil && req.URL.Scheme != "" {
+			req.scheme = req.URL.Scheme
+		} else {
+			req.scheme = "http"
+		}
+	}
+	return req.scheme
 }
 
 func (req *Request) JsonDecode(obj interface{}) error {
 
 	if len(req.RawBody()) < 2 {
+		if req.bodyErr != nil {
+			return req.bodyErr
+		}
 		return fmt.Errorf("No Data Found")
 	}
 
@@ -20,10 +20,15 @@ import (
 )
 
 type Response struct {
-	Status     int
-	Out        http.ResponseWriter
-	buf        *bytes.Buffer
-	compWriter compressWriter
+	Status       int
+	Out          http.ResponseWriter
+	buf          *bytes.Buffer
+	compWriter   compressWriter
+	compEncoding string // "gzip" or "br", the encoding of compWriter
+	streaming    bool
+
+	// run with the final status, headers and body before they are written
+	commitHooks []func(status int, header http.Header, body []byte)
 }
 
 type compressWriter interface {
@@ -41,11 +46,81 @@ func newResponse(w http.ResponseWriter) *Response {
 
 func (resp *Response) Write(b []byte) (int, error) {
 	if resp.compWriter != nil {
-		return resp.compWriter.Write(b)
+		n, err := resp.compWriter.Write(b)
+		if err == nil && resp.streaming {
+			err = resp.drain()
+		}
+		return n, err
+	}
+	if resp.streaming {
+		return resp.Out.Write(b)
 	}
 	return resp.buf.Write(b)
 }
 
+// Stream sends the status and headers set so far, and the output written
+// afterwards goes to the client as it is flushed, e.g. for the server-sent
+// events or a progressive rendering:
+//
+//	c.Response.Header().Set("Content-Type", "text/event-stream")
+//	c.Response.Stream()
+//	for ev := range events {
+//		fmt.Fprintf(c.Response, "data: %s\n\n", ev)
+//		c.Response.Flush()
+//	}
+//
+// A compressed response stays compressed, each Flush flushing the gzip or
+// brotli writer. The commit hooks, such as the one of the sessions, run with
+// an empty body, so the streamed responses get no ETag and are not cached.
+func (resp *Response) Stream() {
+
+	if resp.streaming {
+		return
+	}
+	resp.streaming = true
+
+	h := resp.Out.Header()
+	h.Del("Content-Length")
+	if resp.compWriter != nil && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", resp.compEncoding)
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	for _, fn := range resp.commitHooks {
+		fn(resp.Status, h, nil)
+	}
+	resp.commitHooks = nil
+
+	if resp.Status > 0 {
+		resp.Out.WriteHeader(resp.Status)
+	} else {
+		resp.Out.WriteHeader(http.StatusOK)
+	}
+
+	resp.drain()
+}
+
+// Flush sends the output written so far to the client, and switches the
+// response to streaming, see Stream.
+func (resp *Response) Flush() {
+	resp.Stream()
+	if resp.compWriter != nil {
+		resp.compWriter.Flush()
+	}
+	resp.drain()
+	http.NewResponseController(resp.Out).Flush()
+}
+
+// drain writes the buffered output to the client.
+func (resp *Response) drain() error {
+	if resp.buf.Len() == 0 {
+		return nil
+	}
+	_, err := resp.Out.Write(resp.buf.Bytes())
+	resp.buf.Reset()
+	return err
+}
+
 func (resp *Response) Header() http.Header {
 	return resp.Out.Header()
 }
@@ -0,0 +1,174 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestResponseStream(t *testing.T) {
+
+	var (
+		srv = NewService()
+		rec *httptest.ResponseRecorder
+		// body sent to the client at the first flush
+		flushed string
+	)
+	srv.Config.CompressResponse = true
+
+	srv.regHandler(&regHandler{
+		pattern: "/events",
+		handlerAction: &handlerAction{
+			name: "Events",
+			fn: func(ctx Ctx) error {
+				resp := ctx.Response()
+				resp.Header().Set("Content-Type", "text/event-stream")
+				ctx.Status(http.StatusAccepted)
+				ctx.Send([]byte("data: 1\n\n"))
+				resp.Flush()
+				flushed = rec.Body.String()
+				ctx.Send([]byte("data: 2\n\n"))
+				resp.WriteHeader(http.StatusInternalServerError)
+				return nil
+			},
+		},
+	})
+	srv.HandleFunc("/flusher", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+			flushed = rec.Body.String()
+		}
+		w.Write([]byte("b"))
+	})
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		encoding string
+		status   int
+		flushed  string
+		body     string
+	}{
+		{"plain", "/events/", "", http.StatusAccepted, "data: 1\n\n", "data: 1\n\ndata: 2\n\n"},
+		{"gzip", "/events/", "gzip", http.StatusAccepted, "data: 1\n\n", "data: 1\n\ndata: 2\n\n"},
+		{"brotli", "/events/", "br", http.StatusAccepted, "data: 1\n\n", "data: 1\n\ndata: 2\n\n"},
+		{"handler func", "/flusher/", "", http.StatusOK, "a", "ab"},
+	}
+
+	decode := func(encoding, s string, complete bool) string {
+		var r io.Reader = strings.NewReader(s)
+		switch encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return "invalid gzip: " + err.Error()
+			}
+			r = zr
+		case "br":
+			r = brotli.NewReader(r)
+		}
+		// A flushed stream lacks its end.
+		b, err := io.ReadAll(r)
+		if err != nil && complete {
+			return "invalid stream: " + err.Error()
+		}
+		return string(b)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.encoding != "" {
+				req.Header.Set("Accept-Encoding", tt.encoding)
+			}
+			rec, flushed = httptest.NewRecorder(), ""
+
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if !rec.Flushed {
+				t.Error("expected a flushed response")
+			}
+			if rec.Header().Get("Content-Length") != "" {
+				t.Errorf("expected no Content-Length, got %q", rec.Header().Get("Content-Length"))
+			}
+			if ce := rec.Header().Get("Content-Encoding"); ce != tt.encoding {
+				t.Errorf("expected encoding %q, got %q", tt.encoding, ce)
+			}
+			if got := decode(tt.encoding, flushed, false); got != tt.flushed {
+				t.Errorf("expected %q at the flush, got %q", tt.flushed, got)
+			}
+			if got := decode(tt.encoding, rec.Body.String(), true); got != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, got)
+			}
+		})
+	}
+}
+
+func TestResponseStreamTimeout(t *testing.T) {
+
+	var (
+		rec     = httptest.NewRecorder()
+		flushed string
+	)
+
+	mod := NewModule()
+	mod.Config.Timeout = 1
+	mod.RegisterAction("/events", func(ctx Ctx) error {
+		resp := ctx.Response()
+		resp.Header().Set("Content-Type", "text/event-stream")
+		ctx.Send([]byte("data: 1\n\n"))
+		resp.Flush()
+		flushed = rec.Body.String()
+		ctx.Send([]byte("data: 2\n\n"))
+		return nil
+	})
+
+	srv := NewService()
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	req := httptest.NewRequest("GET", "/events/", nil)
+	h, urlPath, _ := srv.router.find(req)
+	h.handle(rec, req, urlPath, urlPath, time.Now())
+
+	if !rec.Flushed || flushed != "data: 1\n\n" {
+		t.Errorf("expected %q at the flush, got %q", "data: 1\n\n", flushed)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("expected 200 with both events, got %d %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected the event-stream type, got %q", ct)
+	}
+}
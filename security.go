@@ -0,0 +1,116 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SecurityPolicy sets the security related headers of the responses.
+// Empty fields are not sent.
+type SecurityPolicy struct {
+	// Strict-Transport-Security, sent over https only.
+	HSTSMaxAge            int  `json:"hsts_max_age,omitempty" toml:"hsts_max_age,omitempty"` // in seconds
+	HSTSIncludeSubdomains bool `json:"hsts_include_subdomains,omitempty" toml:"hsts_include_subdomains,omitempty"`
+	HSTSPreload           bool `json:"hsts_preload,omitempty" toml:"hsts_preload,omitempty"`
+
+	// Content-Security-Policy, e.g. "default-src 'self'; script-src 'self' 'nonce-{nonce}'".
+	// Each "{nonce}" is replaced by a random value generated per request, which
+	// templates read from the CSP_NONCE data item.
+	ContentSecurityPolicy string `json:"content_security_policy,omitempty" toml:"content_security_policy,omitempty"`
+
+	// Send Content-Security-Policy-Report-Only instead of Content-Security-Policy.
+	CSPReportOnly bool `json:"csp_report_only,omitempty" toml:"csp_report_only,omitempty"`
+
+	FrameOptions              string `json:"frame_options,omitempty" toml:"frame_options,omitempty"` // e.g. "DENY", "SAMEORIGIN"
+	ContentTypeNosniff        bool   `json:"content_type_nosniff,omitempty" toml:"content_type_nosniff,omitempty"`
+	ReferrerPolicy            string `json:"referrer_policy,omitempty" toml:"referrer_policy,omitempty"`
+	PermissionsPolicy         string `json:"permissions_policy,omitempty" toml:"permissions_policy,omitempty"`
+	CrossOriginOpenerPolicy   string `json:"cross_origin_opener_policy,omitempty" toml:"cross_origin_opener_policy,omitempty"`
+	CrossOriginEmbedderPolicy string `json:"cross_origin_embedder_policy,omitempty" toml:"cross_origin_embedder_policy,omitempty"`
+}
+
+// DefaultSecurityPolicy is a strict policy suitable for most applications.
+// It may be copied and customized before being set to Config.Security.
+var DefaultSecurityPolicy = SecurityPolicy{
+	HSTSMaxAge:              63072000, // 2 years
+	HSTSIncludeSubdomains:   true,
+	ContentSecurityPolicy:   "default-src 'self'; script-src 'self' 'nonce-{nonce}'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+	FrameOptions:            "DENY",
+	ContentTypeNosniff:      true,
+	ReferrerPolicy:          "strict-origin-when-cross-origin",
+	PermissionsPolicy:       "camera=(), microphone=(), geolocation=()",
+	CrossOriginOpenerPolicy: "same-origin",
+}
+
+func (p *SecurityPolicy) apply(h http.Header, req *Request) {
+
+	if p.HSTSMaxAge > 0 && req.Scheme() == "https" {
+		v := "max-age=" + strconv.Itoa(p.HSTSMaxAge)
+		if p.HSTSIncludeSubdomains {
+			v += "; includeSubDomains"
+		}
+		if p.HSTSPreload {
+			v += "; preload"
+		}
+		h.Set("Strict-Transport-Security", v)
+	}
+
+	if p.ContentSecurityPolicy != "" {
+		v := p.ContentSecurityPolicy
+		if strings.Contains(v, "{nonce}") {
+			v = strings.ReplaceAll(v, "{nonce}", req.CSPNonce())
+		}
+		if p.CSPReportOnly {
+			h.Set("Content-Security-Policy-Report-Only", v)
+		} else {
+			h.Set("Content-Security-Policy", v)
+		}
+	}
+
+	if p.FrameOptions != "" {
+		h.Set("X-Frame-Options", p.FrameOptions)
+	}
+	if p.ContentTypeNosniff {
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+	if p.ReferrerPolicy != "" {
+		h.Set("Referrer-Policy", p.ReferrerPolicy)
+	}
+	if p.PermissionsPolicy != "" {
+		h.Set("Permissions-Policy", p.PermissionsPolicy)
+	}
+	if p.CrossOriginOpenerPolicy != "" {
+		h.Set("Cross-Origin-Opener-Policy", p.CrossOriginOpenerPolicy)
+	}
+	if p.CrossOriginEmbedderPolicy != "" {
+		h.Set("Cross-Origin-Embedder-Policy", p.CrossOriginEmbedderPolicy)
+	}
+}
+
+// CSPNonce returns the random nonce of the request, to be used in the
+// Content-Security-Policy and in the nonce attribute of inline scripts.
+func (req *Request) CSPNonce() string {
+	if req.cspNonce == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		req.cspNonce = base64.StdEncoding.EncodeToString(b)
+	}
+	return req.cspNonce
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityPolicy(t *testing.T) {
+
+	policy := DefaultSecurityPolicy
+
+	mod := NewModule()
+	mod.RegisterAction("/page", func(ctx Ctx) error {
+		return ctx.Send([]byte("page"))
+	})
+	mod.RegisterAction("/embed", func(ctx Ctx) error {
+		return ctx.Send([]byte("embed"))
+	})
+	mod.SetRouteConfig("/embed", RouteConfig{
+		Security: &SecurityPolicy{FrameOptions: "SAMEORIGIN"},
+	})
+
+	srv := NewService()
+	srv.Config.Security = &policy
+	srv.HandleModule("/", mod)
+	for _, h := range srv.handlers {
+		srv.router.add(h.pattern, h)
+	}
+
+	var nonce string
+	srv.Filters = append(srv.Filters, func(c *Controller) {
+		nonce, _ = c.Data["CSP_NONCE"].(string)
+	})
+
+	req := httptest.NewRequest("GET", "/page/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+
+	h, urlPath, _ := srv.router.find(req)
+	h.handle(rec, req, urlPath, urlPath, time.Now())
+
+	if v := rec.Header().Get("Strict-Transport-Security"); v != "max-age=63072000; includeSubDomains" {
+		t.Errorf("unexpected hsts %q", v)
+	}
+	if v := rec.Header().Get("X-Frame-Options"); v != "DENY" {
+		t.Errorf("unexpected frame options %q", v)
+	}
+	if v := rec.Header().Get("X-Content-Type-Options"); v != "nosniff" {
+		t.Errorf("unexpected content type options %q", v)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); nonce == "" ||
+		!strings.Contains(csp, "'nonce-"+nonce+"'") {
+		t.Errorf("expected csp with nonce %q, got %q", nonce, csp)
+	}
+
+	// per-route override, and no hsts over http
+	req = httptest.NewRequest("GET", "/embed/", nil)
+	rec = httptest.NewRecorder()
+
+	h, urlPath, _ = srv.router.find(req)
+	h.handle(rec, req, urlPath, urlPath, time.Now())
+
+	if v := rec.Header().Get("X-Frame-Options"); v != "SAMEORIGIN" {
+		t.Errorf("unexpected frame options %q", v)
+	}
+	for _, k := range []string{"Strict-Transport-Security", "Content-Security-Policy", "X-Content-Type-Options"} {
+		if v := rec.Header().Get(k); v != "" {
+			t.Errorf("unexpected header %s: %q", k, v)
+		}
+	}
+}
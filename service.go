@@ -31,9 +31,26 @@ import (
 type Service struct {
 	mu sync.RWMutex
 
-	Config  Config
+	Config Config
+
+	// Filters run before the controller actions, not before the file servers
+	// nor the handler funcs, see RouteConfig.Filters.
 	Filters []Filter
 
+	// RequestFilters run before the routing, e.g. MethodOverrideFilter.
+	RequestFilters []RequestFilter
+
+	// Maintenance, when set, may answer all requests with a 503 page.
+	Maintenance *Maintenance
+
+	// Limiter, when set, caps the requests in flight of all the routes.
+	Limiter *ConcurrencyLimiter
+
+	// Sessions keeps the sessions of Controller.Session, in memory when nil.
+	Sessions *SessionManager
+
+	defaultSessions *SessionManager
+
 	router *rootRouter
 
 	server *http.Server
@@ -41,6 +58,8 @@ type Service struct {
 	modules  []*Module
 	handlers []*regHandler
 
+	proxies *ipNetList
+
 	TemplateLoader *TemplateLoader
 }
 
@@ -101,7 +120,9 @@ func (s *Service) HandleModule(pattern string, mod *Module) {
 	}
 
 	modr := &handlerModuler{
-		actions: map[string]*handlerController{},
+		actions:   map[string]*handlerController{},
+		configs:   map[string]*RouteConfig{},
+		modConfig: mod.Config.merge(nil),
 	}
 
 	for _, h := range mod.handlers {
@@ -112,15 +133,18 @@ func (s *Service) HandleModule(pattern string, mod *Module) {
 			s.regHandler(&regHandler{
 				pattern:           mod1.Path + "/" + h.pattern,
 				handlerController: h.handlerController,
+				config:            mod.routeConfig(h),
 			})
 			//
 			modr.actions[h.pattern] = h.handlerController
+			modr.configs[h.pattern] = mod.routeConfig(h)
 
 		} else if h.handlerAction != nil {
 			//
 			s.regHandler(&regHandler{
 				pattern:       filepath.Clean(mod1.Path + "/" + h.pattern),
 				handlerAction: h.handlerAction,
+				config:        mod.routeConfig(h),
 			})
 
 		} else if h.handlerFileServer != nil {
@@ -129,6 +153,7 @@ func (s *Service) HandleModule(pattern string, mod *Module) {
 			s.regHandler(&regHandler{
 				pattern:           filepath.Clean(mod1.Path + "/" + h.pattern),
 				handlerFileServer: h.handlerFileServer,
+				config:            mod.routeConfig(h),
 			})
 		}
 	}
@@ -160,6 +185,7 @@ func (s *Service) HandleModule(pattern string, mod *Module) {
 		s.regHandler(&regHandler{
 			pattern:           filepath.Clean(mod1.Path + "/" + r.pattern),
 			handlerController: h.handlerController,
+			config:            mod.routeConfig(&regHandler{pattern: r.pattern, handlerController: h.handlerController}),
 		})
 	}
 
@@ -235,6 +261,18 @@ func (s *Service) Start(args ...interface{}) error {
 		s.Config.HttpTimeout = 600
 	}
 
+	httpTimeout := func(v uint16) time.Duration {
+		if v == 0 {
+			v = s.Config.HttpTimeout
+		}
+		return time.Duration(v) * time.Second
+	}
+
+	//
+	s.mu.Lock()
+	s.proxies = parseIPNetList(s.Config.TrustedProxies)
+	s.mu.Unlock()
+
 	//
 	sort.Slice(s.handlers, func(i, j int) bool {
 		return strings.Compare(s.handlers[i].pattern, s.handlers[j].pattern) < 0
@@ -250,11 +288,13 @@ func (s *Service) Start(args ...interface{}) error {
 	//
 
 	s.server = &http.Server{
-		Addr:           localAddr,
-		ReadTimeout:    time.Duration(s.Config.HttpTimeout) * time.Second,
-		WriteTimeout:   time.Duration(s.Config.HttpTimeout) * time.Second,
-		MaxHeaderBytes: 1 << 20,
-		Handler:        &rootHandler{s},
+		Addr:              localAddr,
+		ReadHeaderTimeout: httpTimeout(s.Config.HttpReadHeaderTimeout),
+		ReadTimeout:       httpTimeout(s.Config.HttpReadTimeout),
+		WriteTimeout:      httpTimeout(s.Config.HttpWriteTimeout),
+		IdleTimeout:       httpTimeout(s.Config.HttpIdleTimeout),
+		MaxHeaderBytes:    1 << 20,
+		Handler:           &rootHandler{s},
 	}
 
 	//
@@ -0,0 +1,181 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// maxSessionCookieSize is the size limit of a cookie in most browsers,
+// including its name and attributes.
+const maxSessionCookieSize = 4096
+
+var (
+	ErrSessionTooLarge = errors.New("session cookie too large")
+	ErrSessionNoKey    = errors.New("session cookie store without key")
+)
+
+// CookieSessionStore keeps the sessions in the cookie itself, authenticated
+// with HMAC-SHA256 and optionally encrypted with AES-GCM, e.g.
+//
+//	store := httpsrv.NewCookieSessionStore(newKey, oldKey)
+//	store.Encrypt = true
+//	srv.Sessions = httpsrv.NewSessionManager(store)
+//
+// The first key signs the new cookies, all the keys are accepted, so a key
+// may be rotated by putting a new one in first place. As there is nothing to
+// delete on the server side, a destroyed session is only forgotten by the
+// client, keep the session lifetime short.
+type CookieSessionStore struct {
+	Keys    [][]byte
+	Encrypt bool
+}
+
+type cookieSessionKey struct {
+	sign []byte
+	enc  cipher.AEAD
+}
+
+func NewCookieSessionStore(keys ...[]byte) *CookieSessionStore {
+	return &CookieSessionStore{
+		Keys: keys,
+	}
+}
+
+// deriveKey returns a sub key of key dedicated to purpose, so the same key
+// is never used for both signing and encryption.
+func (it *CookieSessionStore) deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("httpsrv session " + purpose))
+	return mac.Sum(nil)
+}
+
+func (it *CookieSessionStore) key(key []byte) (*cookieSessionKey, error) {
+	k := &cookieSessionKey{
+		sign: it.deriveKey(key, "sign"),
+	}
+	if it.Encrypt {
+		block, err := aes.NewCipher(it.deriveKey(key, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		if k.enc, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (it *CookieSessionStore) Save(id string, data *SessionData) (string, error) {
+
+	if len(it.Keys) == 0 {
+		return "", ErrSessionNoKey
+	}
+
+	k, err := it.key(it.Keys[0])
+	if err != nil {
+		return "", err
+	}
+
+	body, err := jsonEncode(data, "")
+	if err != nil {
+		return "", err
+	}
+
+	if k.enc != nil {
+		nonce := make([]byte, k.enc.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		body = k.enc.Seal(nonce, nonce, body, nil)
+	}
+
+	mac := hmac.New(sha256.New, k.sign)
+	mac.Write(body)
+
+	value := base64.RawURLEncoding.EncodeToString(body) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	if len(value) > maxSessionCookieSize {
+		return "", ErrSessionTooLarge
+	}
+
+	return value, nil
+}
+
+func (it *CookieSessionStore) Load(value string) (*SessionData, error) {
+
+	n := strings.LastIndexByte(value, '.')
+	if n < 0 {
+		return nil, nil
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(value[:n])
+	if err != nil {
+		return nil, nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(value[n+1:])
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, key := range it.Keys {
+
+		k, err := it.key(key)
+		if err != nil {
+			return nil, err
+		}
+
+		mac := hmac.New(sha256.New, k.sign)
+		mac.Write(body)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			continue
+		}
+
+		if k.enc != nil {
+			ns := k.enc.NonceSize()
+			if len(body) < ns {
+				return nil, nil
+			}
+			if body, err = k.enc.Open(nil, body[:ns], body[ns:], nil); err != nil {
+				return nil, nil
+			}
+		}
+
+		var data SessionData
+		if err := jsonDecode(body, &data); err != nil {
+			return nil, nil
+		}
+		if data.expired(time.Now()) {
+			return nil, nil
+		}
+		return &data, nil
+	}
+
+	return nil, nil
+}
+
+// Delete does nothing, the session is dropped with its cookie.
+func (it *CookieSessionStore) Delete(id string) error {
+	return nil
+}
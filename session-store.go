@@ -0,0 +1,238 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionData is the stored state of a session.
+type SessionData struct {
+	ID       string            `json:"id"`
+	Values   map[string]string `json:"values"`
+	Flash    map[string]string `json:"flash,omitempty"`
+	Created  time.Time         `json:"created"`
+	Accessed time.Time         `json:"accessed"`
+	Expires  time.Time         `json:"expires"`
+}
+
+// SessionStore is the storage backend of a SessionManager.
+type SessionStore interface {
+	// Load returns the session of a cookie value, or nil when it does not
+	// exist or has expired.
+	Load(value string) (*SessionData, error)
+
+	// Save stores the session, and returns the cookie value which loads it,
+	// the id for the stores keeping the sessions on the server side.
+	Save(id string, data *SessionData) (string, error)
+
+	Delete(id string) error
+}
+
+var ErrSessionID = errors.New("invalid session id")
+
+type memorySessionStore struct {
+	mu    sync.Mutex
+	items map[string]*SessionData
+	saves int
+}
+
+// memorySessionPurgeInterval is the number of saves between two purges of
+// the expired sessions of a memory store.
+const memorySessionPurgeInterval = 1024
+
+// NewMemorySessionStore returns a store keeping the sessions in the memory
+// of the process, they are lost on restart.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		items: map[string]*SessionData{},
+	}
+}
+
+func (it *SessionData) clone() *SessionData {
+	v := *it
+	v.Values = make(map[string]string, len(it.Values))
+	for k, val := range it.Values {
+		v.Values[k] = val
+	}
+	if it.Flash != nil {
+		v.Flash = make(map[string]string, len(it.Flash))
+		for k, val := range it.Flash {
+			v.Flash[k] = val
+		}
+	}
+	return &v
+}
+
+func (it *SessionData) expired(now time.Time) bool {
+	return !it.Expires.IsZero() && !now.Before(it.Expires)
+}
+
+func (it *memorySessionStore) Load(id string) (*SessionData, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	data, ok := it.items[id]
+	if !ok {
+		return nil, nil
+	}
+	if data.expired(time.Now()) {
+		delete(it.items, id)
+		return nil, nil
+	}
+	return data.clone(), nil
+}
+
+func (it *memorySessionStore) Save(id string, data *SessionData) (string, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.items[id] = data.clone()
+	if it.saves++; it.saves%memorySessionPurgeInterval == 0 {
+		now := time.Now()
+		for k, v := range it.items {
+			if v.expired(now) {
+				delete(it.items, k)
+			}
+		}
+	}
+	return id, nil
+}
+
+func (it *memorySessionStore) Delete(id string) error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	delete(it.items, id)
+	return nil
+}
+
+// FileSessionStore keeps the sessions as JSON files in a directory.
+type FileSessionStore struct {
+	dir string
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{
+		dir: dir,
+	}, nil
+}
+
+func (it *FileSessionStore) path(id string) (string, error) {
+	if id == "" || len(id) > 128 {
+		return "", ErrSessionID
+	}
+	for i := 0; i < len(id); i++ {
+		if !isAlnum(id[i]) && id[i] != '-' && id[i] != '_' {
+			return "", ErrSessionID
+		}
+	}
+	return filepath.Join(it.dir, id+".json"), nil
+}
+
+func (it *FileSessionStore) Load(id string) (*SessionData, error) {
+
+	file, err := it.path(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var data SessionData
+	if err := jsonDecode(b, &data); err != nil {
+		return nil, err
+	}
+	if data.expired(time.Now()) {
+		os.Remove(file)
+		return nil, nil
+	}
+
+	return &data, nil
+}
+
+func (it *FileSessionStore) Save(id string, data *SessionData) (string, error) {
+
+	file, err := it.path(id)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := jsonEncode(data, "")
+	if err != nil {
+		return "", err
+	}
+
+	// Write a temporary file and rename it, so readers never see a partial session.
+	fp, err := os.CreateTemp(it.dir, ".session-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = fp.Write(b)
+	if err2 := fp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (it *FileSessionStore) Delete(id string) error {
+	file, err := it.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Purge removes the files of the expired sessions.
+func (it *FileSessionStore) Purge() error {
+
+	entries, err := os.ReadDir(it.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		// Load removes the file of an expired session.
+		it.Load(strings.TrimSuffix(name, ".json"))
+	}
+
+	return nil
+}
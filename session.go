@@ -14,16 +14,337 @@
 
 package httpsrv
 
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// defaultSessionMaxAge is the lifetime of the sessions of a SessionManager
+// without MaxAge.
+const defaultSessionMaxAge = 24 * time.Hour
+
+// SessionManager keeps the sessions of a service in a SessionStore, the
+// client holding the session id in a cookie, e.g.
+//
+//	store, _ := httpsrv.NewFileSessionStore("/var/lib/app/sessions")
+//	srv.Sessions = httpsrv.NewSessionManager(store)
+//
+// A service without Sessions keeps them in memory.
+type SessionManager struct {
+	Store SessionStore
+
+	// Name of the cookie, default Config.CookieKeySession.
+	CookieName   string
+	CookiePath   string // default "/"
+	CookieDomain string
+	SameSite     http.SameSite // default Lax
+
+	// CookieSecure always sets the Secure attribute, by default it is only
+	// set when the client uses https. CookieScriptAccess omits HttpOnly,
+	// letting the scripts of the pages read the cookie.
+	CookieSecure       bool
+	CookieScriptAccess bool
+
+	// Lifetime of the sessions from their creation, default 24 hours.
+	MaxAge time.Duration
+
+	// Sessions without activity for IdleTimeout expire, zero disables.
+	IdleTimeout time.Duration
+}
+
+// Session is the session of a request, loaded on first use and saved after
+// the action if it was changed.
 type Session struct {
 	c *Controller
+	m *SessionManager
+
+	id       string
+	data     *SessionData
+	flash    map[string]string // messages of the previous request
+	loaded   bool
+	dirty    bool
+	deleteID string // id of a destroyed session, deleted from the store
+	expire   bool   // expire the cookie
+}
+
+func NewSessionManager(store SessionStore) *SessionManager {
+	return &SessionManager{
+		Store: store,
+	}
+}
+
+func (m *SessionManager) cookieName(c *Controller) string {
+	if m.CookieName != "" {
+		return m.CookieName
+	}
+	if c.service != nil && c.service.Config.CookieKeySession != "" {
+		return c.service.Config.CookieKeySession
+	}
+	return DefaultConfig.CookieKeySession
+}
+
+func (m *SessionManager) maxAge() time.Duration {
+	if m.MaxAge > 0 {
+		return m.MaxAge
+	}
+	return defaultSessionMaxAge
+}
+
+func (m *SessionManager) cookie(c *Controller, value string, maxAge time.Duration) *http.Cookie {
+	ck := &http.Cookie{
+		Name:     m.cookieName(c),
+		Value:    value,
+		Path:     m.CookiePath,
+		Domain:   m.CookieDomain,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   m.CookieSecure || c.Request.Scheme() == "https",
+		HttpOnly: !m.CookieScriptAccess,
+		SameSite: m.SameSite,
+	}
+	if ck.Path == "" {
+		ck.Path = "/"
+	}
+	if ck.SameSite == 0 {
+		ck.SameSite = http.SameSiteLaxMode
+	}
+	if maxAge < 0 {
+		ck.MaxAge = -1
+	}
+	return ck
+}
+
+func (s *Service) sessionManager() *SessionManager {
+	if s.Sessions != nil {
+		return s.Sessions
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.defaultSessions == nil {
+		s.defaultSessions = NewSessionManager(NewMemorySessionStore())
+	}
+	return s.defaultSessions
 }
 
 func SessionFilter(c *Controller) {
-	c.Session = &Session{
+	s := &Session{
 		c: c,
 	}
+	if c.service != nil {
+		s.m = c.service.sessionManager()
+	}
+	c.Session = s
+	c.Response.commitHooks = append(c.Response.commitHooks, s.commit)
+}
+
+// templateData sets the flash messages of the session as the FLASH of the
+// templates. The session is loaded on first use, by an action or here.
+func (s *Session) templateData(data map[string]interface{}) {
+	if s == nil || s.m == nil {
+		return
+	}
+	if _, ok := data["FLASH"]; ok {
+		return
+	}
+	if !s.loaded {
+		if _, err := s.c.Request.Cookie(s.m.cookieName(s.c)); err != nil {
+			return
+		}
+	}
+	if flash := s.Flashes(); len(flash) > 0 {
+		data["FLASH"] = flash
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// valid reports whether a stored session is still alive at now.
+func (m *SessionManager) valid(data *SessionData, now time.Time) bool {
+	if data.expired(now) || !now.Before(data.Created.Add(m.maxAge())) {
+		return false
+	}
+	return m.IdleTimeout <= 0 || data.Accessed.IsZero() ||
+		now.Before(data.Accessed.Add(m.IdleTimeout))
+}
+
+func (s *Session) load() {
+
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+
+	now := time.Now()
+
+	if s.m != nil && s.m.Store != nil {
+		if ck, err := s.c.Request.Cookie(s.m.cookieName(s.c)); err == nil && ck.Value != "" {
+			data, err := s.m.Store.Load(ck.Value)
+			if err != nil {
+				slog.Warn("httpsrv session load fail", "err", err)
+			} else if data != nil {
+				if s.m.valid(data, now) {
+					s.data, s.id = data, data.ID
+				} else {
+					s.deleteID, s.expire = data.ID, true
+				}
+			}
+		}
+	}
+
+	if s.data == nil {
+		s.data = &SessionData{}
+	}
+	if s.data.Values == nil {
+		s.data.Values = map[string]string{}
+	}
+
+	if len(s.data.Flash) > 0 {
+		// The flash messages are delivered once.
+		s.flash, s.data.Flash = s.data.Flash, nil
+		s.dirty = true
+	} else if s.id != "" && s.m.IdleTimeout > 0 &&
+		now.Sub(s.data.Accessed) >= s.m.IdleTimeout/10 {
+		// Record the activity, at most ten times per idle timeout.
+		s.dirty = true
+	}
+}
+
+// ID returns the id of the session, empty for a new session.
+func (s *Session) ID() string {
+	s.load()
+	return s.id
+}
+
+// Get returns the value of key, or an empty string.
+func (s *Session) Get(key string) string {
+	s.load()
+	return s.data.Values[key]
+}
+
+func (s *Session) Set(key, value string) {
+	s.load()
+	s.data.Values[key] = value
+	s.dirty = true
+}
+
+func (s *Session) Delete(key string) {
+	s.load()
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.dirty = true
+	}
+}
+
+// Clear removes all the values of the session.
+func (s *Session) Clear() {
+	s.load()
+	if len(s.data.Values) > 0 {
+		s.data.Values = map[string]string{}
+		s.dirty = true
+	}
+}
+
+// Regenerate moves the session to a new id and drops the former one, e.g.
+// after a login to prevent the session fixation.
+func (s *Session) Regenerate() {
+	s.load()
+	if s.id != "" {
+		s.deleteID = s.id
+	}
+	s.id = ""
+	s.dirty = true
+}
+
+// Flash sets a message for the next request only, usually the target of a
+// Controller.Redirect, where templates read it as {{.FLASH.key}}.
+func (s *Session) Flash(key, msg string) {
+	s.load()
+	if s.data.Flash == nil {
+		s.data.Flash = map[string]string{}
+	}
+	s.data.Flash[key] = msg
+	s.dirty = true
+}
+
+// Flashes returns the messages set by the previous request.
+func (s *Session) Flashes() map[string]string {
+	s.load()
+	return s.flash
+}
+
+// Destroy removes the session from the store and expires its cookie. Values
+// set afterwards go to a new session.
+func (s *Session) Destroy() {
+	s.load()
+	if s.id != "" {
+		s.deleteID = s.id
+	}
+	s.id = ""
+	s.data = &SessionData{
+		Values: map[string]string{},
+	}
+	s.dirty = false
+	s.expire = true
+}
+
+// commit saves the changed session before the response is written.
+func (s *Session) commit(status int, header http.Header, body []byte) {
+
+	if s.m == nil || s.m.Store == nil {
+		return
+	}
+
+	if s.deleteID != "" {
+		if err := s.m.Store.Delete(s.deleteID); err != nil {
+			slog.Warn("httpsrv session delete fail", "err", err)
+		}
+	}
+
+	if !s.dirty {
+		if s.expire {
+			header.Add("Set-Cookie", s.m.cookie(s.c, "", -1).String())
+		}
+		return
+	}
+
+	var (
+		now    = time.Now()
+		maxAge = s.m.maxAge()
+	)
+
+	if s.id == "" {
+		s.id = newSessionID()
+		s.data.Created = now
+	}
+	s.data.ID = s.id
+	s.data.Accessed = now
+	s.data.Expires = s.data.Created.Add(maxAge)
+	if s.m.IdleTimeout > 0 && now.Add(s.m.IdleTimeout).Before(s.data.Expires) {
+		s.data.Expires = now.Add(s.m.IdleTimeout)
+	}
+
+	value, err := s.m.Store.Save(s.id, s.data)
+	if err != nil {
+		slog.Warn("httpsrv session save fail", "err", err)
+		return
+	}
+
+	ck := s.m.cookie(s.c, value, s.data.Expires.Sub(now)).String()
+	if len(ck) > maxSessionCookieSize {
+		slog.Warn("httpsrv session save fail", "err", ErrSessionTooLarge, "size", len(ck))
+		return
+	}
+
+	header.Add("Set-Cookie", ck)
 }
 
+// Value returns the value of the cookie key, or else of the parameter key.
 func (s *Session) Value(key string) string {
 
 	if v, err := s.c.Request.Cookie(key); err == nil {
@@ -0,0 +1,352 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionManager(t *testing.T) {
+
+	srv := NewService()
+	srv.Config.CookieKeySession = "sid"
+
+	srv.regHandler(&regHandler{
+		pattern: "/session",
+		handlerAction: &handlerAction{
+			name: "Session",
+			fn: func(ctx Ctx) error {
+				s := ctx.(*ctxImpl).c.Session
+				switch ctx.Params().Value("op") {
+				case "set":
+					s.Set("user", "alice")
+				case "destroy":
+					s.Destroy()
+				}
+				return ctx.Send([]byte(s.Get("user")))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	serve := func(op string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/session/?op="+op, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		return rec
+	}
+
+	rec := serve("get", nil)
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("expected no cookie for an unchanged session")
+	}
+
+	rec = serve("set", nil)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "sid" || !cookies[0].HttpOnly {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+	sid := cookies[0]
+
+	if rec = serve("get", sid); rec.Body.String() != "alice" {
+		t.Errorf("expected the stored value, got %q", rec.Body.String())
+	}
+
+	rec = serve("destroy", sid)
+	if cookies = rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected an expired cookie, got %v", cookies)
+	}
+
+	if rec = serve("get", sid); rec.Body.String() != "" {
+		t.Errorf("expected the session to be destroyed, got %q", rec.Body.String())
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &SessionData{
+		ID:      newSessionID(),
+		Values:  map[string]string{"user": "alice"},
+		Expires: time.Now().Add(time.Hour),
+	}
+	if _, err := store.Save(data.ID, data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		id    string
+		found bool
+	}{
+		{"stored", data.ID, true},
+		{"unknown", newSessionID(), false},
+		{"invalid", "../etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := store.Load(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (v != nil) != tt.found {
+				t.Fatalf("expected found %v, got %v", tt.found, v)
+			}
+			if v != nil && v.Values["user"] != "alice" {
+				t.Errorf("expected the stored value, got %v", v.Values)
+			}
+		})
+	}
+
+	data.Expires = time.Now().Add(-time.Second)
+	store.Save(data.ID, data)
+	if v, _ := store.Load(data.ID); v != nil {
+		t.Error("expected an expired session not to load")
+	}
+}
+
+func TestCookieSessionStore(t *testing.T) {
+
+	var (
+		oldKey = []byte("old-secret-key-0123456789abcdef")
+		newKey = []byte("new-secret-key-0123456789abcdef")
+		data   = &SessionData{
+			ID:      newSessionID(),
+			Values:  map[string]string{"user": "alice"},
+			Expires: time.Now().Add(time.Hour),
+		}
+	)
+
+	for _, encrypt := range []bool{false, true} {
+
+		oldStore := &CookieSessionStore{Keys: [][]byte{oldKey}, Encrypt: encrypt}
+		store := &CookieSessionStore{Keys: [][]byte{newKey, oldKey}, Encrypt: encrypt}
+
+		value, err := oldStore.Save(data.ID, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encrypt && strings.Contains(value, "alice") {
+			t.Fatal("expected an encrypted cookie value")
+		}
+
+		tampered := []byte(value)
+		tampered[4] ^= 1
+
+		tests := []struct {
+			name  string
+			store *CookieSessionStore
+			value string
+			found bool
+		}{
+			{"same key", oldStore, value, true},
+			{"rotated key", store, value, true},
+			{"unknown key", &CookieSessionStore{Keys: [][]byte{newKey}, Encrypt: encrypt}, value, false},
+			{"tampered", store, string(tampered), false},
+			{"malformed", store, "abc", false},
+		}
+
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s encrypt=%v", tt.name, encrypt), func(t *testing.T) {
+				v, err := tt.store.Load(tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (v != nil) != tt.found {
+					t.Fatalf("expected found %v, got %v", tt.found, v)
+				}
+				if v != nil && v.Values["user"] != "alice" {
+					t.Errorf("expected the stored value, got %v", v.Values)
+				}
+			})
+		}
+	}
+
+	large := &SessionData{
+		Values: map[string]string{"blob": strings.Repeat("x", maxSessionCookieSize)},
+	}
+	if _, err := NewCookieSessionStore(newKey).Save("id", large); err != ErrSessionTooLarge {
+		t.Errorf("expected ErrSessionTooLarge, got %v", err)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+
+	srv := NewService()
+	srv.Sessions = NewSessionManager(NewMemorySessionStore())
+	srv.Sessions.CookieName = "sid"
+
+	srv.regHandler(&regHandler{
+		pattern: "/login",
+		handlerAction: &handlerAction{
+			name: "Login",
+			fn: func(ctx Ctx) error {
+				c := ctx.(*ctxImpl).c
+				switch ctx.Params().Value("op") {
+				case "visit":
+					c.Session.Set("visited", "1")
+				case "login":
+					c.Session.Regenerate()
+					c.Session.Set("user", "alice")
+					c.Session.Flash("notice", "Welcome back")
+					c.Redirect("/home")
+					return nil
+				}
+				c.Session.templateData(c.Data)
+				notice, _ := c.Data["FLASH"].(map[string]string)
+				return ctx.Send([]byte(c.Session.Get("user") + "|" + notice["notice"]))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	var sid *http.Cookie
+	serve := func(op string) string {
+		req := httptest.NewRequest("GET", "/login/?op="+op, nil)
+		if sid != nil {
+			req.AddCookie(sid)
+		}
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		for _, ck := range rec.Result().Cookies() {
+			sid = ck
+		}
+		return rec.Body.String()
+	}
+
+	serve("visit")
+	anonymous := sid.Value
+
+	serve("login")
+	if sid.Value == anonymous {
+		t.Fatal("expected a new session id after Regenerate")
+	}
+	if data, _ := srv.Sessions.Store.Load(anonymous); data != nil {
+		t.Error("expected the former session to be deleted")
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"flash after redirect", "alice|Welcome back"},
+		{"flash consumed", "alice|"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if body := serve("show"); body != tt.body {
+				t.Errorf("expected %q, got %q", tt.body, body)
+			}
+		})
+	}
+
+	srv.Sessions.IdleTimeout = 20 * time.Millisecond
+	serve("show")
+	time.Sleep(30 * time.Millisecond)
+	if body := serve("show"); body != "|" {
+		t.Errorf("expected the idle session to expire, got %q", body)
+	}
+
+	srv.Sessions.IdleTimeout = 0
+	srv.Sessions.MaxAge = 20 * time.Millisecond
+	serve("visit")
+	time.Sleep(30 * time.Millisecond)
+	if body := serve("show"); body != "|" {
+		t.Errorf("expected the session to expire, got %q", body)
+	}
+}
+
+// loadCountStore counts the loads of a SessionStore.
+type loadCountStore struct {
+	SessionStore
+	loads int
+}
+
+func (it *loadCountStore) Load(value string) (*SessionData, error) {
+	it.loads++
+	return it.SessionStore.Load(value)
+}
+
+func TestSessionLazyLoad(t *testing.T) {
+
+	store := &loadCountStore{SessionStore: NewMemorySessionStore()}
+
+	srv := NewService()
+	srv.Sessions = NewSessionManager(store)
+
+	srv.regHandler(&regHandler{
+		pattern: "/page",
+		handlerAction: &handlerAction{
+			name: "Page",
+			fn: func(ctx Ctx) error {
+				c := ctx.(*ctxImpl).c
+				switch ctx.Params().Value("op") {
+				case "set":
+					c.Session.Set("user", "alice")
+				case "get":
+					return ctx.Send([]byte(c.Session.Get("user")))
+				}
+				return ctx.Send([]byte("page"))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	var sid *http.Cookie
+	serve := func(op string) string {
+		req := httptest.NewRequest("GET", "/page/?op="+op, nil)
+		if sid != nil {
+			req.AddCookie(sid)
+		}
+		rec := httptest.NewRecorder()
+		h, urlPath, _ := srv.router.find(req)
+		h.handle(rec, req, urlPath, urlPath, time.Now())
+		for _, ck := range rec.Result().Cookies() {
+			sid = ck
+		}
+		return rec.Body.String()
+	}
+
+	serve("set")
+	if sid == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	store.loads = 0
+	if body := serve("none"); body != "page" || store.loads != 0 {
+		t.Errorf("expected no session load, got %q with %d loads", body, store.loads)
+	}
+	if body := serve("get"); body != "alice" || store.loads != 1 {
+		t.Errorf("expected alice with 1 load, got %q with %d loads", body, store.loads)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"bufio"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+)
+
+// sniffLen is the number of bytes read to detect a content type.
+const sniffLen = 512
+
+// UploadFile is a file of a multipart form parsed by Params.
+type UploadFile struct {
+	Filename string
+	Size     int64
+
+	// ContentType is detected from the content, the type sent by the client
+	// is in Header.
+	ContentType string
+	Header      textproto.MIMEHeader
+
+	fh *multipart.FileHeader
+}
+
+// UploadPart is a part of a multipart form read by a MultipartStream.
+type UploadPart struct {
+	FormName string
+	Filename string // empty for the form fields
+	Header   textproto.MIMEHeader
+
+	r *bufio.Reader
+}
+
+// MultipartStream reads a multipart form part by part, so large files go
+// to their destination without being buffered, e.g.
+//
+//	ms, err := c.Request.MultipartStream()
+//	if err != nil {
+//		...
+//	}
+//	for ms.Next() {
+//		part := ms.Part()
+//		if part.Filename != "" {
+//			part.SaveTo(filepath.Join(dir, filepath.Base(part.Filename)))
+//		}
+//	}
+//	if err := ms.Err(); err != nil {
+//		...
+//	}
+//
+// The body size and file size limits of the route apply, the request is
+// answered with a 413 when one is exceeded. It must not be mixed with the
+// form values of Params, which parse the whole form.
+type MultipartStream struct {
+	req  *Request
+	mr   *multipart.Reader
+	part *UploadPart
+	cur  *multipart.Part
+	err  error
+}
+
+// File returns the first file of the form field name, or
+// http.ErrMissingFile.
+func (p *Params) File(name string) (*UploadFile, error) {
+	files, err := p.files(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// Files returns all the files of the form field name.
+func (p *Params) Files(name string) []*UploadFile {
+	files, _ := p.files(name)
+	return files
+}
+
+func (p *Params) files(name string) ([]*UploadFile, error) {
+
+	if p.request == nil {
+		return nil, http.ErrMissingFile
+	}
+	p.init()
+
+	if p.req != nil && p.req.bodyErr != nil {
+		return nil, p.req.bodyErr
+	}
+	if p.request.MultipartForm == nil {
+		return nil, http.ErrNotMultipart
+	}
+
+	var files []*UploadFile
+	for _, fh := range p.request.MultipartForm.File[name] {
+		f := &UploadFile{
+			Filename: fh.Filename,
+			Size:     fh.Size,
+			Header:   fh.Header,
+			fh:       fh,
+		}
+		if fp, err := fh.Open(); err == nil {
+			buf := make([]byte, sniffLen)
+			n, _ := io.ReadFull(fp, buf)
+			f.ContentType = http.DetectContentType(buf[:n])
+			fp.Close()
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// Open returns the content of the file.
+func (f *UploadFile) Open() (multipart.File, error) {
+	return f.fh.Open()
+}
+
+// SaveTo copies the file to path.
+func (f *UploadFile) SaveTo(path string) error {
+	src, err := f.fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = saveFile(path, src)
+	return err
+}
+
+func saveFile(path string, src io.Reader) (int64, error) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(fp, src)
+	if err2 := fp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return n, err
+}
+
+// MultipartStream returns a reader of the multipart form of the request.
+func (req *Request) MultipartStream() (*MultipartStream, error) {
+	if req.bodyErr != nil {
+		return nil, req.bodyErr
+	}
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	return &MultipartStream{
+		req: req,
+		mr:  mr,
+	}, nil
+}
+
+// Next advances to the next part, and reports whether there is one.
+func (ms *MultipartStream) Next() bool {
+
+	if ms.err != nil {
+		return false
+	}
+	if ms.cur != nil {
+		ms.cur.Close()
+		ms.cur, ms.part = nil, nil
+	}
+
+	part, err := ms.mr.NextPart()
+	if err != nil {
+		if err != io.EOF {
+			ms.fail(err)
+		}
+		return false
+	}
+
+	var r io.Reader = part
+	if part.FileName() != "" && ms.req.maxFileSize > 0 {
+		r = &limitedPartReader{
+			r: part,
+			n: ms.req.maxFileSize,
+		}
+	} else if part.FileName() == "" {
+		// The form fields are kept to the multipart memory limit.
+		limit := ms.req.maxMultipartMemory
+		if limit <= 0 {
+			limit = defaultMultipartMemory
+		}
+		r = &limitedPartReader{
+			r: part,
+			n: limit,
+		}
+	}
+
+	ms.cur = part
+	ms.part = &UploadPart{
+		FormName: part.FormName(),
+		Filename: part.FileName(),
+		Header:   part.Header,
+		r:        bufio.NewReaderSize(&streamErrReader{r: r, ms: ms}, sniffLen),
+	}
+
+	return true
+}
+
+// Part returns the current part.
+func (ms *MultipartStream) Part() *UploadPart {
+	return ms.part
+}
+
+// Err returns the first error of the stream.
+func (ms *MultipartStream) Err() error {
+	return ms.err
+}
+
+func (ms *MultipartStream) fail(err error) {
+	if ms.err == nil {
+		ms.err = err
+		ms.req.setBodyErr(err)
+	}
+}
+
+func (p *UploadPart) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+// ContentType returns the type detected from the first bytes of the part.
+func (p *UploadPart) ContentType() string {
+	b, _ := p.r.Peek(sniffLen)
+	return http.DetectContentType(b)
+}
+
+// Value reads the part as a form field value.
+func (p *UploadPart) Value() (string, error) {
+	b, err := io.ReadAll(p.r)
+	return string(b), err
+}
+
+// SaveTo copies the part to path, and returns the number of bytes written.
+// The file is removed if the copy fails, e.g. on a size limit.
+func (p *UploadPart) SaveTo(path string) (int64, error) {
+	return saveFile(path, p.r)
+}
+
+// limitedPartReader fails with a *http.MaxBytesError when the part exceeds n bytes.
+type limitedPartReader struct {
+	r    io.Reader
+	n    int64
+	read int64
+}
+
+func (lr *limitedPartReader) Read(b []byte) (int, error) {
+	n, err := lr.r.Read(b)
+	if lr.read += int64(n); lr.read > lr.n {
+		return 0, &http.MaxBytesError{Limit: lr.n}
+	}
+	return n, err
+}
+
+// streamErrReader records the read errors, such as the size limits, on the stream.
+type streamErrReader struct {
+	r  io.Reader
+	ms *MultipartStream
+}
+
+func (sr *streamErrReader) Read(b []byte) (int, error) {
+	n, err := sr.r.Read(b)
+	if err != nil && err != io.EOF {
+		sr.ms.fail(err)
+	}
+	return n, err
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var uploadPNG = []byte("\x89PNG\x0D\x0A\x1A\x0A....")
+
+func newUploadRequest(files map[string][]byte) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("title", "photos")
+	for name, data := range files {
+		fw, _ := mw.CreateFormFile("photo", name)
+		fw.Write(data)
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/upload/", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestParamsFiles(t *testing.T) {
+
+	r := newUploadRequest(map[string][]byte{
+		"a.png": uploadPNG,
+		"b.txt": []byte("hello"),
+	})
+	p := &Params{request: r, req: newRequest(r)}
+
+	if v := p.Value("title"); v != "photos" {
+		t.Errorf("expected the form value, got %q", v)
+	}
+
+	files := p.Files("photo")
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+
+	types := map[string]string{}
+	for _, f := range files {
+		types[f.Filename] = f.ContentType
+	}
+	if types["a.png"] != "image/png" || !strings.HasPrefix(types["b.txt"], "text/plain") {
+		t.Errorf("unexpected sniffed types %v", types)
+	}
+
+	f, err := p.File("photo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "saved", f.Filename)
+	if err := f.SaveTo(path); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Stat(path); err != nil || st.Size() != f.Size {
+		t.Errorf("expected a saved file of %d bytes, got %v %v", f.Size, st, err)
+	}
+
+	if _, err := p.File("missing"); err != http.ErrMissingFile {
+		t.Errorf("expected ErrMissingFile, got %v", err)
+	}
+}
+
+func TestMultipartStream(t *testing.T) {
+
+	var (
+		srv = NewService()
+		dir = t.TempDir()
+	)
+	srv.Config.MaxFileSize = 16
+
+	srv.regHandler(&regHandler{
+		pattern: "/upload",
+		handlerAction: &handlerAction{
+			name: "Upload",
+			fn: func(ctx Ctx) error {
+				ms, err := ctx.Request().MultipartStream()
+				if err != nil {
+					return err
+				}
+				var out []string
+				for ms.Next() {
+					part := ms.Part()
+					if part.Filename == "" {
+						v, _ := part.Value()
+						out = append(out, part.FormName+"="+v)
+						continue
+					}
+					n, err := part.SaveTo(filepath.Join(dir, part.Filename))
+					if err != nil {
+						return nil
+					}
+					out = append(out, fmt.Sprintf("%s:%d", part.Filename, n))
+				}
+				if ms.Err() != nil {
+					return nil
+				}
+				return ctx.Send([]byte(strings.Join(out, ",")))
+			},
+		},
+	})
+	lastHandler := srv.handlers[len(srv.handlers)-1]
+	srv.router.add(lastHandler.pattern, lastHandler)
+
+	tests := []struct {
+		name   string
+		file   []byte
+		status int
+		body   string
+	}{
+		{"small", []byte("hello"), http.StatusOK, "title=photos,a.txt:5"},
+		{"too large", bytes.Repeat([]byte("x"), 64), http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newUploadRequest(map[string][]byte{"a.txt": tt.file})
+			rec := httptest.NewRecorder()
+			h, urlPath, _ := srv.router.find(req)
+			h.handle(rec, req, urlPath, urlPath, time.Now())
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("expected %q, got %q", tt.body, rec.Body.String())
+			}
+			if _, err := os.Stat(filepath.Join(dir, "a.txt")); (err == nil) != (tt.status == http.StatusOK) {
+				t.Errorf("unexpected saved file state: %v", err)
+			}
+			os.Remove(filepath.Join(dir, "a.txt"))
+		})
+	}
+}
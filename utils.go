@@ -17,6 +17,7 @@ package httpsrv
 import (
 	"encoding/json"
 	"hash/crc64"
+	"strings"
 )
 
 // var bytesBufferPool = sync.Pool{
@@ -52,6 +53,23 @@ func isUpper(v byte) bool {
 	return false
 }
 
+// snakeCase converts a Go identifier to snake case, e.g. "UserID" to "user_id".
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUpper(c) {
+			if i > 0 && (!isUpper(s[i-1]) || (i+1 < len(s) && !isUpper(s[i+1]) && s[i+1] != '_')) &&
+				s[i-1] != '_' {
+				b.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
 var crc64ecma182 = crc64.MakeTable(crc64.ECMA)
 
 func crc64Checksum(b []byte) uint64 {
@@ -0,0 +1,393 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidatorFunc reports whether a non-zero field value passes a rule, param
+// is the text after "=" in the tag, e.g. "3" for `validate:"min=3"`.
+type ValidatorFunc func(value any, param string) bool
+
+var (
+	validatorMu sync.RWMutex
+	validators  = map[string]ValidatorFunc{}
+
+	validateRegexps sync.Map
+
+	// Messages of the rules, translated with the "validate.<rule>" keys of
+	// the i18n files, where %[1]s is the field and %[2]s the rule param.
+	// These are the only verbs, with %% for a percent sign: a plain %s or %d
+	// is left as is.
+	validateMessages = map[string]string{
+		"invalid":  "%[1]s has an invalid value",
+		"required": "%[1]s is required",
+		"min":      "%[1]s must be at least %[2]s",
+		"max":      "%[1]s must be at most %[2]s",
+		"len":      "%[1]s must have a length of %[2]s",
+		"regex":    "%[1]s has an invalid format",
+		"email":    "%[1]s must be a valid email address",
+		"oneof":    "%[1]s must be one of %[2]s",
+	}
+)
+
+// RegisterValidator adds a custom rule, used in the validate tags by name.
+func RegisterValidator(name string, fn ValidatorFunc) {
+	validatorMu.Lock()
+	defer validatorMu.Unlock()
+	validators[name] = fn
+}
+
+// Message returns the message of the error in the language of locale.
+func (e *FieldError) Message(locale string) string {
+
+	rule := e.Rule
+	if rule == "" {
+		rule = "invalid"
+	}
+
+	key := "validate." + rule
+	msg := i18nTranslate(locale, key)
+	if msg == key {
+		if msg = validateMessages[rule]; msg == "" {
+			msg = "%[1]s is invalid"
+		}
+	}
+
+	// Only the verbs of the message are replaced, a translation may omit the
+	// parameter.
+	return strings.NewReplacer(
+		"%[1]s", e.Field,
+		"%[2]s", strings.ReplaceAll(e.Param, " ", ", "),
+		"%%", "%",
+	).Replace(msg)
+}
+
+// Validate checks the fields of the struct v against the rules of their
+// validate tags, and returns the failures as FieldErrors, e.g.
+//
+//	type Signup struct {
+//		Name  string `validate:"required,min=3,max=20"`
+//		Email string `validate:"required,email"`
+//		Plan  string `validate:"oneof=free pro"`
+//		Code  string `validate:"len=6,regex=^[0-9]+$"`
+//	}
+//
+// The rules but "required" apply to the non-zero values only. A regex rule
+// must be the last one of its tag, as it may hold commas. Params.Bind
+// validates the struct it fills.
+func Validate(v any) error {
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+
+	var errs FieldErrors
+	if err := validateStruct(rv, "", nil, &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateStruct validates the fields of v, but the ones listed in skip.
+func validateStruct(v reflect.Value, prefix string, skip map[string]bool, errs *FieldErrors) error {
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		var (
+			sf   = t.Field(i)
+			fv   = v.Field(i)
+			name = validateFieldName(sf)
+		)
+
+		if !sf.IsExported() && (!sf.Anonymous || sf.Type.Kind() != reflect.Struct) {
+			continue
+		}
+
+		if bindStructType(sf.Type) != nil {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			childPrefix := prefix
+			if !sf.Anonymous || sf.Tag.Get("param") != "" {
+				childPrefix = prefix + name + "."
+			}
+			if err := validateStruct(fv, childPrefix, skip, errs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag := sf.Tag.Get("validate")
+
+		if sf.Type.Kind() == reflect.Slice && bindStructType(sf.Type.Elem()) != nil {
+			for j := 0; j < fv.Len(); j++ {
+				ev := fv.Index(j)
+				if ev.Kind() == reflect.Pointer {
+					if ev.IsNil() {
+						continue
+					}
+					ev = ev.Elem()
+				}
+				if err := validateStruct(ev, prefix+name+"."+strconv.Itoa(j)+".", skip, errs); err != nil {
+					return err
+				}
+			}
+		}
+
+		if tag == "" || skip[prefix+name] {
+			continue
+		}
+
+		fe, err := validateField(fv, tag)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", prefix+name, err)
+		}
+		if fe != nil {
+			fe.Field = prefix + name
+			*errs = append(*errs, fe)
+		}
+	}
+
+	return nil
+}
+
+func validateFieldName(sf reflect.StructField) string {
+	name := sf.Tag.Get("param")
+	if name == "-" {
+		name, _, _ = strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			name = ""
+		}
+	}
+	if name == "" {
+		name = snakeCase(sf.Name)
+	}
+	return name
+}
+
+// validateField returns the first rule of tag that v fails.
+func validateField(v reflect.Value, tag string) (*FieldError, error) {
+
+	for tag != "" {
+
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "" {
+			continue
+		}
+
+		if name == "required" {
+			if v.IsZero() || (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+				return &FieldError{Rule: name}, nil
+			}
+			continue
+		}
+
+		if v.IsZero() {
+			return nil, nil
+		}
+
+		ok, err := validateRule(reflect.Indirect(v), name, param)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			fe := &FieldError{
+				Rule:  name,
+				Param: param,
+			}
+			if s, ok := reflect.Indirect(v).Interface().(string); ok {
+				fe.Value = s
+			}
+			return fe, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func validateRule(v reflect.Value, name, param string) (bool, error) {
+
+	switch name {
+
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s param %q", name, param)
+		}
+		size, ok := validateSize(v)
+		if !ok {
+			return false, fmt.Errorf("rule %s does not apply to %s", name, v.Type())
+		}
+		switch name {
+		case "min":
+			return size >= n, nil
+		case "max":
+			return size <= n, nil
+		}
+		return size == n, nil
+
+	case "email":
+		s, ok := v.Interface().(string)
+		if !ok {
+			return false, fmt.Errorf("rule email does not apply to %s", v.Type())
+		}
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s, nil
+
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, item := range strings.Fields(param) {
+			if item == s {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "regex":
+		re, err := validateRegexp(param)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprint(v.Interface())), nil
+	}
+
+	validatorMu.RLock()
+	fn, ok := validators[name]
+	validatorMu.RUnlock()
+
+	if !ok {
+		return false, errors.New("unknown validate rule " + name)
+	}
+
+	return fn(v.Interface(), param), nil
+}
+
+// validateSize returns the length of the strings, slices and maps, or the
+// value of the numbers.
+func validateSize(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func validateRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := validateRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	validateRegexps.Store(expr, re)
+	return re, nil
+}
+
+// RenderFieldErrors answers the errors of Params.Bind or Validate. The
+// FieldErrors get a 422 JSON response with the messages in the language of
+// the request, e.g.
+//
+//	{"message":"Unprocessable Entity","errors":[{"field":"name","rule":"required","message":"name is required"}]}
+//
+// and the other errors a 400 one, such as a malformed body, or a 415 one for
+// an ErrUnsupportedMediaType of Request.Decode. The text of these errors is
+// logged, not sent to the client.
+func (c *Controller) RenderFieldErrors(err error) {
+
+	type fieldError struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Param   string `json:"param,omitempty"`
+		Message string `json:"message"`
+	}
+
+	var (
+		fes    FieldErrors
+		status = http.StatusUnprocessableEntity
+		body   = struct {
+			Message string       `json:"message"`
+			Errors  []fieldError `json:"errors,omitempty"`
+		}{
+			Message: http.StatusText(http.StatusUnprocessableEntity),
+		}
+	)
+
+	if errors.As(err, &fes) {
+		for _, fe := range fes {
+			rule := fe.Rule
+			if rule == "" {
+				rule = "invalid"
+			}
+			body.Errors = append(body.Errors, fieldError{
+				Field:   fe.Field,
+				Rule:    rule,
+				Param:   fe.Param,
+				Message: fe.Message(c.Request.Locale),
+			})
+		}
+	} else {
+		status = http.StatusBadRequest
+		if c.Request.bodyTooLarge() {
+			status = http.StatusRequestEntityTooLarge
+		} else if errors.Is(err, ErrUnsupportedMediaType) {
+			status = http.StatusUnsupportedMediaType
+		}
+		slog.Debug("httpsrv request error", "path", c.Request.UrlPath(), "err", err)
+		body.Message = http.StatusText(status)
+	}
+
+	c.Response.WriteHeader(status)
+	c.RenderJson(body)
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Eryx <evorui at gmail dot com>, All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type validateSignup struct {
+	Name    string   `validate:"required,min=3,max=8"`
+	Email   string   `validate:"required,email"`
+	Plan    string   `validate:"oneof=free pro"`
+	Code    string   `validate:"len=4,regex=^[0-9]+$"`
+	Age     int      `validate:"min=18"`
+	Tags    []string `validate:"max=2"`
+	Coupon  string   `validate:"even"`
+	Address struct {
+		City string `validate:"required"`
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	RegisterValidator("even", func(value any, param string) bool {
+		return len(value.(string))%2 == 0
+	})
+
+	valid := func() validateSignup {
+		v := validateSignup{
+			Name:  "alice",
+			Email: "alice@example.com",
+			Plan:  "pro",
+			Code:  "0042",
+			Age:   30,
+			Tags:  []string{"a"},
+		}
+		v.Address.City = "Paris"
+		return v
+	}
+
+	tests := []struct {
+		name  string
+		fn    func(v *validateSignup)
+		field string
+		rule  string
+	}{
+		{"valid", func(v *validateSignup) {}, "", ""},
+		{"required", func(v *validateSignup) { v.Name = "" }, "name", "required"},
+		{"min", func(v *validateSignup) { v.Name = "al" }, "name", "min"},
+		{"max", func(v *validateSignup) { v.Name = "alexandra" }, "name", "max"},
+		{"email", func(v *validateSignup) { v.Email = "alice" }, "email", "email"},
+		{"oneof", func(v *validateSignup) { v.Plan = "gold" }, "plan", "oneof"},
+		{"optional", func(v *validateSignup) { v.Plan = "" }, "", ""},
+		{"len", func(v *validateSignup) { v.Code = "042" }, "code", "len"},
+		{"regex", func(v *validateSignup) { v.Code = "04a2" }, "code", "regex"},
+		{"number", func(v *validateSignup) { v.Age = 17 }, "age", "min"},
+		{"slice", func(v *validateSignup) { v.Tags = []string{"a", "b", "c"} }, "tags", "max"},
+		{"custom", func(v *validateSignup) { v.Coupon = "abc" }, "coupon", "even"},
+		{"nested", func(v *validateSignup) { v.Address.City = "" }, "address.city", "required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := valid()
+			tt.fn(&v)
+			err := Validate(&v)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var errs FieldErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("expected 1 field error, got %v", err)
+			}
+			if errs[0].Field != tt.field || errs[0].Rule != tt.rule {
+				t.Errorf("expected %s %s, got %s %s", tt.field, tt.rule, errs[0].Field, errs[0].Rule)
+			}
+		})
+	}
+}
+
+func TestRenderFieldErrors(t *testing.T) {
+
+	i18nMut.Lock()
+	i18n["fr.validate.required"] = "%[1]s est obligatoire"
+	i18nMut.Unlock()
+
+	t.Cleanup(func() {
+		i18nMut.Lock()
+		delete(i18n, "fr.validate.required")
+		i18nMut.Unlock()
+	})
+
+	r := httptest.NewRequest("GET", "/signup?age=x", nil)
+	c := newController(nil, newRequest(r), newResponse(httptest.NewRecorder()))
+	c.Params = &Params{request: r}
+	c.Request.Locale = "fr"
+
+	var v struct {
+		Name string `validate:"required"`
+		Age  int    `validate:"min=18"`
+	}
+	c.RenderFieldErrors(c.Params.Bind(&v))
+
+	if c.Response.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", c.Response.Status)
+	}
+
+	var body struct {
+		Errors []struct {
+			Field   string `json:"field"`
+			Rule    string `json:"rule"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(c.Response.buf.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Errors) != 2 {
+		t.Fatalf("expected 2 errors, got %s", c.Response.buf.String())
+	}
+	if e := body.Errors[0]; e.Field != "age" || e.Rule != "invalid" {
+		t.Errorf("expected the age conversion error, got %+v", e)
+	}
+	if e := body.Errors[1]; e.Field != "name" || !strings.Contains(e.Message, "obligatoire") {
+		t.Errorf("expected a translated required error, got %+v", e)
+	}
+
+	// the text of the other errors is not sent
+	c = newController(nil, newRequest(r), newResponse(httptest.NewRecorder()))
+	c.RenderFieldErrors(errors.New("open /srv/data/secret.db: permission denied"))
+	if c.Response.Status != http.StatusBadRequest ||
+		strings.Contains(c.Response.buf.String(), "secret") {
+		t.Errorf("expected a generic 400, got %d %s", c.Response.Status, c.Response.buf.String())
+	}
+}
+
+func TestFieldErrorMessage(t *testing.T) {
+
+	i18nMut.Lock()
+	i18n["fr.validate.min"] = "valeur trop petite"
+	i18n["fr.validate.max"] = "%[2]s au plus pour %[1]s (100%%)"
+	i18nMut.Unlock()
+
+	t.Cleanup(func() {
+		i18nMut.Lock()
+		delete(i18n, "fr.validate.min")
+		delete(i18n, "fr.validate.max")
+		i18nMut.Unlock()
+	})
+
+	tests := []struct {
+		locale string
+		rule   string
+		msg    string
+	}{
+		{"en", "min", "age must be at least 18"},
+		{"fr", "min", "valeur trop petite"},
+		{"fr", "max", "18 au plus pour age (100%)"},
+		{"en", "custom", "age is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale+" "+tt.rule, func(t *testing.T) {
+			e := &FieldError{Field: "age", Rule: tt.rule, Param: "18"}
+			if msg := e.Message(tt.locale); msg != tt.msg {
+				t.Errorf("expected %q, got %q", tt.msg, msg)
+			}
+		})
+	}
+}